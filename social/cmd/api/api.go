@@ -2,43 +2,65 @@ package main
 
 import (
 	"context"
+	"database/sql"
 	"errors"
+	"expvar"
 	"fmt"
-	"log"
 	"net/http"
 	"os"
 	"os/signal"
 	"social/docs"
+	"social/internal/auth"
+	"social/internal/mailer"
+	"social/internal/ratelimiter"
 	"social/internal/store"
+	"social/internal/store/cache"
 	"syscall"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	httpSwagger "github.com/swaggo/http-swagger/v2"
 	"go.uber.org/zap"
 )
 
 type application struct {
-	config config
-	store  store.Storage
-	// cacheStorage  cache.Storage
-	logger *zap.SugaredLogger
-	// mailer        mailer.Client
-	// authenticator auth.Authenticator
-	// rateLimiter   ratelimiter.Limiter
+	config        config
+	db            *sql.DB
+	store         store.Storage
+	cacheStorage  cache.Storage
+	logger        *zap.SugaredLogger
+	mailer        mailer.Client
+	authenticator auth.Authenticator
+	rateLimiter   ratelimiter.Limiter
+	// per route group limiters, see rateLimiterGroups
+	groupRateLimiters map[string]ratelimiter.Limiter
+	// dependencies probed by the readiness endpoint
+	healthChecks []healthCheck
 }
 
 type config struct {
 	addr        string
 	db          dbConfig
 	env         string
+	logLevel    string
 	apiURL      string
 	mail        mailConfig
 	frontendURL string
 	auth        authConfig
 	redisCfg    redisConfig
-	// rateLimiter ratelimiter.Config
+	rateLimiter ratelimiter.Config
+	// overrides of rateLimiter for a single route group, keyed by group name
+	rateLimiterGroups map[string]ratelimiter.Config
+	// when set /metrics is served on this address instead of addr
+	metricsAddr string
+	// otlp, stdout or none, see newTracerProvider
+	traceExporter string
+	// key signing the feed and comments pagination cursors
+	cursorSecret string
+	// apply pending migrations before serving
+	migrateOnStart bool
 }
 
 type redisConfig struct {
@@ -65,14 +87,26 @@ type basicConfig struct {
 }
 
 type mailConfig struct {
+	// one of sendgrid, mailtrap, smtp, file or stdout
+	provider  string
 	sendGrid  sendGridConfig
 	mailTrap  mailTrapConfig
+	smtp      smtpConfig
+	filePath  string
 	fromEmail string
 	exp       time.Duration
 }
 
 type mailTrapConfig struct {
-	apiKey string
+	apiKey  string
+	inboxID string
+}
+
+type smtpConfig struct {
+	host     string
+	port     int
+	username string
+	password string
 }
 
 type sendGridConfig struct {
@@ -91,7 +125,10 @@ func (app *application) mount() http.Handler {
 
 	r.Use(middleware.RequestID)
 	r.Use(middleware.RealIP)
-	r.Use(middleware.Logger)
+	r.Use(app.TracingMiddleware)
+	r.Use(app.AccessLogMiddleware)
+	r.Use(app.ExpvarMiddleware)
+	r.Use(app.MetricsMiddleware)
 	r.Use(middleware.Recoverer)
 	// r.Use(cors.Handler(cors.Options{
 	// 	AllowedOrigins:   []string{env.GetString("CORS_ALLOWED_ORIGIN", "http://localhost:5174")},
@@ -102,57 +139,86 @@ func (app *application) mount() http.Handler {
 	// 	MaxAge:           300, // Maximum value not ignored by any of major browsers
 	// }))
 
-	// if app.config.rateLimiter.Enabled {
-	// 	r.Use(app.RateLimiterMiddleware)
-	// }
+	if app.config.rateLimiter.Enabled {
+		r.Use(app.RateLimiterMiddleware)
+	}
 
 	// Set a timeout value on the request context (ctx), that will signal
 	// through ctx.Done() that the request has timed out and further
 	// processing should be stopped.
 	r.Use(middleware.Timeout(60 * time.Second))
 
+	if app.config.metricsAddr == "" {
+		r.With(app.BasicAuthMiddleware()).Get("/metrics", promhttp.Handler().ServeHTTP)
+	}
+
 	r.Route("/v1", func(r chi.Router) {
 		// Operations
-		r.Get("/health", app.healthCheckHandler)
-		// r.With(app.BasicAuthMiddleware()).Get("/debug/vars", expvar.Handler().ServeHTTP)
+		r.Route("/health", func(r chi.Router) {
+			r.Get("/", app.readinessHandler)
+			r.Get("/live", app.livenessHandler)
+			r.Get("/ready", app.readinessHandler)
+		})
+		r.With(app.BasicAuthMiddleware()).Get("/debug/vars", expvar.Handler().ServeHTTP)
 
 		docsURL := fmt.Sprintf("%s/swagger/doc.json", app.config.addr)
 		r.Get("/swagger/*", httpSwagger.Handler(httpSwagger.URL(docsURL)))
 
 		r.Route("/posts", func(r chi.Router) {
-			// r.Use(app.AuthTokenMiddleware)
+			r.Use(app.AuthTokenMiddleware)
+			r.Use(app.groupRateLimiterMiddleware("posts"))
 			r.Post("/", app.createPostHandler)
+			r.Get("/search", app.searchPostsHandler)
 
 			r.Route("/{postID}", func(r chi.Router) {
 				r.Use(app.postsContextMiddleware)
 				r.Get("/", app.getPostHandler)
 
-				// r.Patch("/", app.checkPostOwnership("moderator", app.updatePostHandler))
-				// r.Delete("/", app.checkPostOwnership("admin", app.deletePostHandler))
+				r.Patch("/", app.checkPostOwnership("moderator", app.updatePostHandler))
+				r.Delete("/", app.checkPostOwnership("admin", app.deletePostHandler))
+
+				r.Route("/comments", func(r chi.Router) {
+					r.Get("/", app.listCommentsHandler)
+					r.Post("/", app.createCommentHandler)
+
+					r.Route("/{commentID}", func(r chi.Router) {
+						r.Use(app.commentsContextMiddleware)
+
+						r.Patch("/", app.checkCommentOwnership("moderator", app.updateCommentHandler))
+						r.Delete("/", app.checkCommentOwnership("moderator", app.deleteCommentHandler))
+					})
+				})
 			})
 		})
 
 		r.Route("/users", func(r chi.Router) {
-			// r.Put("/activate/{token}", app.activateUserHandler)
+			r.Put("/activate/{token}", app.activateUserHandler)
 
 			r.Route("/{userID}", func(r chi.Router) {
-				// r.Use(app.AuthTokenMiddleware)
-				//
-				// r.Get("/", app.getUserHandler)
-				// r.Put("/follow", app.followUserHandler)
-				// r.Put("/unfollow", app.unfollowUserHandler)
+				r.Use(app.AuthTokenMiddleware)
+				r.Use(app.groupRateLimiterMiddleware("users"))
+
+				r.Get("/", app.getUserHandler)
+				r.Put("/follow", app.followUserHandler)
+				r.Put("/unfollow", app.unfollowUserHandler)
+				r.Get("/followers", app.listFollowersHandler)
+				r.Get("/following", app.listFollowingHandler)
 			})
 
-			// r.Group(func(r chi.Router) {
-			// 	// r.Use(app.AuthTokenMiddleware)
-			// 	r.Get("/feed", app.getUserFeedHandler)
-			// })
+			r.Group(func(r chi.Router) {
+				r.Use(app.AuthTokenMiddleware)
+				r.Use(app.groupRateLimiterMiddleware("users"))
+				r.Get("/feed", app.getUserFeedHandler)
+				r.Get("/by-username/{name}", app.getUserByUsernameHandler)
+			})
 		})
 
 		// Public routes
 		r.Route("/authentication", func(r chi.Router) {
-			// r.Post("/user", app.registerUserHandler)
-			// r.Post("/token", app.createTokenHandler)
+			r.Use(app.groupRateLimiterMiddleware("authentication"))
+
+			r.Post("/user", app.registerUserHandler)
+			r.Post("/token", app.createTokenHandler)
 		})
 	})
 
@@ -173,6 +239,20 @@ func (app *application) run(mux http.Handler) error {
 		IdleTimeout:  time.Minute,
 	}
 
+	var metricsSrv *http.Server
+	if app.config.metricsAddr != "" {
+		metricsSrv = newMetricsServer(app.config.metricsAddr)
+
+		go func() {
+			app.logger.Infow("metrics server has started", "addr", app.config.metricsAddr)
+
+			err := metricsSrv.ListenAndServe()
+			if !errors.Is(err, http.ErrServerClosed) {
+				app.logger.Errorw("metrics server failed", "addr", app.config.metricsAddr, "error", err)
+			}
+		}()
+	}
+
 	shutdown := make(chan error)
 
 	go func() {
@@ -184,12 +264,18 @@ func (app *application) run(mux http.Handler) error {
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 
-		log.Printf("signal caught: %s", s.String())
+		app.logger.Infow("signal caught", "signal", s.String())
+
+		if metricsSrv != nil {
+			if err := metricsSrv.Shutdown(ctx); err != nil {
+				app.logger.Errorw("metrics server shutdown failed", "error", err)
+			}
+		}
 
 		shutdown <- srv.Shutdown(ctx)
 	}()
 
-	// app.logger.Infow("server has started", "addr", app.config.addr, "env", app.config.env)
+	app.logger.Infow("server has started", "addr", app.config.addr, "env", app.config.env)
 
 	err := srv.ListenAndServe()
 	if !errors.Is(err, http.ErrServerClosed) {
@@ -201,7 +287,7 @@ func (app *application) run(mux http.Handler) error {
 		return err
 	}
 
-	// app.logger.Infow("server has stopped", "addr", app.config.addr, "env", app.config.env)
+	app.logger.Infow("server has stopped", "addr", app.config.addr, "env", app.config.env)
 
 	return nil
 }
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"social/internal/store"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type commentKey string
+
+const commentCtx commentKey = "comment"
+
+type CreateCommentPayload struct {
+	Content string `json:"content" validate:"required,max=1000"`
+	// set to reply to a comment on the same post
+	ParentID *int64 `json:"parent_id" validate:"omitempty,gte=1"`
+}
+
+type UpdateCommentPayload struct {
+	Content string `json:"content" validate:"required,max=1000"`
+}
+
+// CreateComment godoc
+//
+//	@Summary		Comments on a post
+//	@Description	Comments on a post as the authenticated user, or replies to one of its
+//	@Description	comments when parent_id is set
+//	@Tags			comments
+//	@Accept			json
+//	@Produce		json
+//	@Param			postID	path		int						true	"Post ID"
+//	@Param			payload	body		CreateCommentPayload	true	"Comment payload"
+//	@Success		201		{object}	store.Comment
+//	@Failure		400		{object}	problem
+//	@Failure		401		{object}	problem
+//	@Failure		404		{object}	problem
+//	@Failure		500		{object}	problem
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postID}/comments [post]
+func (app *application) createCommentHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreateCommentPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	post := getPostFromCtx(r)
+	user := getUserFromContext(r)
+
+	comment := &store.Comment{
+		PostID:   post.ID,
+		UserID:   user.ID,
+		ParentID: payload.ParentID,
+		Content:  payload.Content,
+		User:     store.User{ID: user.ID, Username: user.Username},
+	}
+
+	if err := app.store.Comments.Create(r.Context(), comment); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, comment); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// commentsResponse is a page of comments along with the cursor of the next
+// one.
+type commentsResponse struct {
+	Data       []store.Comment `json:"data"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+}
+
+// ListComments godoc
+//
+//	@Summary		Lists the comments of a post
+//	@Description	Lists the comments of a post as a tree, every level oldest first. Only
+//	@Description	depth levels, the oldest 10 replies of a comment and 500 comments in all
+//	@Description	are loaded. Comments with a reply_count above their replies have more of
+//	@Description	the thread to expand by listing again with them as the parent.
+//	@Description	The first level is paginated, pass the next_cursor of a page (also sent
+//	@Description	in the Link header) as the cursor of the next request.
+//	@Tags			comments
+//	@Produce		json
+//	@Param			postID	path		int		true	"Post ID"
+//	@Param			parent	query		int		false	"Only the replies to this comment"
+//	@Param			depth	query		int		false	"Levels of replies to load, 1 to 10"
+//	@Param			limit	query		int		false	"Comments of the first level per page, 1 to 50"
+//	@Param			cursor	query		string	false	"Cursor from a previous page"
+//	@Success		200		{object}	commentsResponse
+//	@Failure		400		{object}	problem
+//	@Failure		401		{object}	problem
+//	@Failure		404		{object}	problem
+//	@Failure		500		{object}	problem
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postID}/comments [get]
+func (app *application) listCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	q := store.CommentThreadQuery{
+		PaginatedCommentsQuery: store.PaginatedCommentsQuery{Limit: 20},
+		MaxDepth:               3,
+	}
+
+	q, err := q.Parse(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(q); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	post := getPostFromCtx(r)
+	scope := commentsCursorScope(post.ID, q.ParentID)
+
+	if token := r.URL.Query().Get("cursor"); token != "" {
+		after, err := app.decodeCursor(scope, token)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		q.After = &after
+	}
+
+	if q.ParentID != nil {
+		parent, err := app.store.Comments.GetByID(ctx, *q.ParentID)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.notFoundResponse(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+
+		if parent.PostID != post.ID {
+			app.notFoundResponse(w, r, store.ErrNotFound)
+			return
+		}
+	}
+
+	thread, err := app.store.Comments.GetThread(ctx, post.ID, q)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	res := commentsResponse{Data: thread}
+
+	res.NextCursor, err = nextPage(app, w, r, scope, thread, q.Limit, func(c store.Comment) (string, int64) {
+		return c.CreatedAt, c.ID
+	})
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := writeJSON(w, http.StatusOK, res); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// UpdateComment godoc
+//
+//	@Summary		Updates a comment
+//	@Description	Updates a comment, only its author or a moderator can
+//	@Tags			comments
+//	@Accept			json
+//	@Produce		json
+//	@Param			postID		path		int						true	"Post ID"
+//	@Param			commentID	path		int						true	"Comment ID"
+//	@Param			payload		body		UpdateCommentPayload	true	"Comment payload"
+//	@Success		200			{object}	store.Comment
+//	@Failure		400			{object}	problem
+//	@Failure		401			{object}	problem
+//	@Failure		403			{object}	problem
+//	@Failure		404			{object}	problem
+//	@Failure		500			{object}	problem
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postID}/comments/{commentID} [patch]
+func (app *application) updateCommentHandler(w http.ResponseWriter, r *http.Request) {
+	comment := getCommentFromCtx(r)
+
+	var payload UpdateCommentPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	comment.Content = payload.Content
+
+	if err := app.store.Comments.Update(r.Context(), comment); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, comment); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// DeleteComment godoc
+//
+//	@Summary		Deletes a comment
+//	@Description	Deletes a comment, only its author or a moderator can
+//	@Tags			comments
+//	@Param			postID		path	int	true	"Post ID"
+//	@Param			commentID	path	int	true	"Comment ID"
+//	@Success		204
+//	@Failure		400	{object}	problem
+//	@Failure		401	{object}	problem
+//	@Failure		403	{object}	problem
+//	@Failure		404	{object}	problem
+//	@Failure		500	{object}	problem
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postID}/comments/{commentID} [delete]
+func (app *application) deleteCommentHandler(w http.ResponseWriter, r *http.Request) {
+	comment := getCommentFromCtx(r)
+
+	if err := app.store.Comments.Delete(r.Context(), comment.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// commentsContextMiddleware loads the {commentID} comment. It runs after
+// postsContextMiddleware: a comment that exists but belongs to another post
+// is not found either.
+func (app *application) commentsContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "commentID"), 10, 64)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+
+		ctx := r.Context()
+
+		comment, err := app.store.Comments.GetByID(ctx, id)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.notFoundResponse(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+
+		if post := getPostFromCtx(r); comment.PostID != post.ID {
+			app.notFoundResponse(w, r, store.ErrNotFound)
+			return
+		}
+
+		ctx = context.WithValue(ctx, commentCtx, comment)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func getCommentFromCtx(r *http.Request) *store.Comment {
+	comment, _ := r.Context().Value(commentCtx).(*store.Comment)
+	return comment
+}
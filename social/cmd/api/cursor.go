@@ -0,0 +1,132 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"social/internal/store"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// cursorPayload is a position in a listing. Scope names the listing and
+// its order, so that a cursor only continues the listing it came from.
+type cursorPayload struct {
+	Scope     string    `json:"s"`
+	CreatedAt time.Time `json:"t"`
+	ID        int64     `json:"id"`
+}
+
+func feedCursorScope(sort string) string {
+	return "feed:" + sort
+}
+
+// commentsCursorScope is the scope of the comments of a post, or of the
+// replies to parentID.
+func commentsCursorScope(postID int64, parentID *int64) string {
+	scope := "comments:" + strconv.FormatInt(postID, 10)
+	if parentID != nil {
+		scope += ":" + strconv.FormatInt(*parentID, 10)
+	}
+
+	return scope
+}
+
+// encodeCursor turns c into the opaque token handed to clients: the
+// base64url encoded position and its HMAC, separated by a dot. Clients can't
+// forge or tamper with cursors, so their content can change freely.
+func (app *application) encodeCursor(scope string, c store.Cursor) (string, error) {
+	payload, err := json.Marshal(cursorPayload{Scope: scope, CreatedAt: c.CreatedAt, ID: c.ID})
+	if err != nil {
+		return "", err
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+
+	return encoded + "." + app.signCursor(encoded), nil
+}
+
+// decodeCursor verifies a token from encodeCursor with the same scope, any
+// malformed or tampered token, or one from another listing, yields
+// errInvalidCursor.
+func (app *application) decodeCursor(scope, token string) (store.Cursor, error) {
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return store.Cursor{}, errInvalidCursor
+	}
+
+	if !hmac.Equal([]byte(signature), []byte(app.signCursor(encoded))) {
+		return store.Cursor{}, errInvalidCursor
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return store.Cursor{}, errInvalidCursor
+	}
+
+	var c cursorPayload
+	if err := json.Unmarshal(payload, &c); err != nil || c.Scope != scope {
+		return store.Cursor{}, errInvalidCursor
+	}
+
+	return store.Cursor{CreatedAt: c.CreatedAt, ID: c.ID}, nil
+}
+
+func (app *application) signCursor(encoded string) string {
+	mac := hmac.New(sha256.New, []byte(app.config.cursorSecret))
+	mac.Write([]byte(encoded))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// nextCursor encodes the position of the last row of a page, given as
+// scanned by the store.
+func (app *application) nextCursor(scope, createdAt string, id int64) (string, error) {
+	c, err := store.CursorOf(createdAt, id)
+	if err != nil {
+		return "", err
+	}
+
+	return app.encodeCursor(scope, c)
+}
+
+// nextPage returns the cursor of the page following page and links to it in
+// the Link header, at gives the position of a row. A short page is the last
+// one, there's no next cursor then.
+func nextPage[T any](app *application, w http.ResponseWriter, r *http.Request, scope string, page []T, limit int, at func(T) (createdAt string, id int64)) (string, error) {
+	// a short page is the last one
+	if len(page) == 0 || len(page) < limit {
+		return "", nil
+	}
+
+	createdAt, id := at(page[len(page)-1])
+
+	cursor, err := app.nextCursor(scope, createdAt, id)
+	if err != nil {
+		return "", err
+	}
+
+	w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, nextPageURL(r, cursor)))
+
+	return cursor, nil
+}
+
+// nextPageURL is the request's URL continuing at cursor, with the same
+// filters.
+func nextPageURL(r *http.Request, cursor string) string {
+	qs := r.URL.Query()
+	qs.Del("offset")
+	qs.Set("cursor", cursor)
+
+	next := url.URL{Path: r.URL.Path, RawQuery: qs.Encode()}
+
+	return next.String()
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http/httptest"
+	"net/url"
+	"social/internal/store"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestCursorApp(secret string) *application {
+	return &application{config: config{cursorSecret: secret}}
+}
+
+var testCursor = store.Cursor{
+	CreatedAt: time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC),
+	ID:        42,
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	app := newTestCursorApp("secret")
+
+	scopes := []string{
+		feedCursorScope("desc"),
+		commentsCursorScope(1, nil),
+		commentsCursorScope(1, &testCursor.ID),
+	}
+
+	for _, scope := range scopes {
+		token, err := app.encodeCursor(scope, testCursor)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := app.decodeCursor(scope, token)
+		if err != nil {
+			t.Fatalf("decoding a %s cursor: %v", scope, err)
+		}
+		if !got.CreatedAt.Equal(testCursor.CreatedAt) || got.ID != testCursor.ID {
+			t.Errorf("decoded %s cursor = %+v, want %+v", scope, got, testCursor)
+		}
+	}
+}
+
+func TestCursorRejected(t *testing.T) {
+	app := newTestCursorApp("secret")
+	scope := feedCursorScope("desc")
+
+	token, err := app.encodeCursor(scope, testCursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, signature, _ := strings.Cut(token, ".")
+
+	// signed returns a token with a valid signature for any payload
+	signed := func(encoded string) string {
+		return encoded + "." + app.signCursor(encoded)
+	}
+	forged, err := newTestCursorApp("other secret").encodeCursor(scope, testCursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPayload, err := app.encodeCursor(scope, store.Cursor{CreatedAt: testCursor.CreatedAt, ID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherEncoded, _, _ := strings.Cut(otherPayload, ".")
+
+	tests := []struct {
+		name  string
+		scope string
+		token string
+	}{
+		{name: "empty", scope: scope, token: ""},
+		{name: "no signature", scope: scope, token: encoded},
+		{name: "tampered signature", scope: scope, token: encoded + "." + strings.ToUpper(signature)},
+		{name: "tampered payload", scope: scope, token: otherEncoded + "." + signature},
+		{name: "signed with another secret", scope: scope, token: forged},
+		{name: "other sort order", scope: feedCursorScope("asc"), token: token},
+		{name: "other listing", scope: commentsCursorScope(1, nil), token: token},
+		{name: "malformed base64", scope: scope, token: signed("not base64!")},
+		{name: "malformed json", scope: scope, token: signed(base64.RawURLEncoding.EncodeToString([]byte("{not json")))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := app.decodeCursor(tt.scope, tt.token)
+			if !errors.Is(err, errInvalidCursor) {
+				t.Errorf("error = %v, want errInvalidCursor", err)
+			}
+		})
+	}
+}
+
+func TestNextPage(t *testing.T) {
+	type row struct {
+		createdAt string
+		id        int64
+	}
+	at := func(r row) (string, int64) { return r.createdAt, r.id }
+
+	full := []row{
+		{"2024-05-01T12:00:00Z", 1},
+		{"2024-05-01T12:30:00Z", 42},
+	}
+
+	tests := []struct {
+		name       string
+		page       []row
+		limit      int
+		wantCursor bool
+	}{
+		{name: "empty page", page: nil, limit: 2},
+		{name: "short page", page: full[:1], limit: 2},
+		{name: "full page", page: full, limit: 2, wantCursor: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestCursorApp("secret")
+			scope := feedCursorScope("desc")
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("GET", "/v1/users/feed?sort=desc&offset=20&limit=2", nil)
+
+			cursor, err := nextPage(app, w, r, scope, tt.page, tt.limit, at)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			link := w.Header().Get("Link")
+			if !tt.wantCursor {
+				if cursor != "" || link != "" {
+					t.Errorf("cursor %q and Link %q on the last page, want none", cursor, link)
+				}
+				return
+			}
+
+			got, err := app.decodeCursor(scope, cursor)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.CreatedAt.Equal(testCursor.CreatedAt) || got.ID != testCursor.ID {
+				t.Errorf("cursor at %+v, want the last row %+v", got, testCursor)
+			}
+
+			next, ok := strings.CutPrefix(link, "<")
+			next, ok2 := strings.CutSuffix(next, `>; rel="next"`)
+			if !ok || !ok2 {
+				t.Fatalf("Link = %q, want a next link", link)
+			}
+
+			u, err := url.Parse(next)
+			if err != nil {
+				t.Fatal(err)
+			}
+			qs := u.Query()
+			if u.Path != "/v1/users/feed" || qs.Get("cursor") != cursor || qs.Get("sort") != "desc" || qs.Get("limit") != "2" || qs.Has("offset") {
+				t.Errorf("next link = %q, want the same filters with the cursor instead of the offset", next)
+			}
+		})
+	}
+}
@@ -1,57 +1,173 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"social/internal/store"
+	"strconv"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// Error codes are part of the API: clients switch on them, so existing ones
+// must never change meaning.
+const (
+	codeInternalError      = "internal_error"
+	codeBadRequest         = "bad_request"
+	codeInvalidJSON        = "invalid_json"
+	codeInvalidQuery       = "invalid_query"
+	codeInvalidCursor      = "invalid_cursor"
+	codeInvalidID          = "invalid_id"
+	codeFollowSelf         = "follow_self"
+	codeValidationFailed   = "validation_failed"
+	codeDuplicateEmail     = "duplicate_email"
+	codeDuplicateUsername  = "duplicate_username"
+	codeForbidden          = "forbidden"
+	codeConflict           = "conflict"
+	codeEditConflict       = "edit_conflict"
+	codePreconditionFailed = "precondition_failed"
+	codeNotFound           = "not_found"
+	codeUnauthorized       = "unauthorized"
+	codeRateLimited        = "rate_limited"
 )
 
 func (app *application) internalServerError(w http.ResponseWriter, r *http.Request, err error) {
-	app.logger.Errorw("internal error", "method", r.Method, "path", r.URL.Path, "error", err.Error())
+	app.requestLogger(r).Errorw("internal error", "method", r.Method, "path", r.URL.Path, "error", err.Error())
 
-	writeJSONError(w, http.StatusInternalServerError, "the server encountered a problem")
+	writeProblem(w, r, problem{
+		Status: http.StatusInternalServerError,
+		Code:   codeInternalError,
+		Detail: "the server encountered a problem",
+	})
 }
 
 func (app *application) forbiddenResponse(w http.ResponseWriter, r *http.Request) {
-	app.logger.Warnw("forbidden", "method", r.Method, "path", r.URL.Path, "error")
+	app.requestLogger(r).Warnw("forbidden", "method", r.Method, "path", r.URL.Path)
 
-	writeJSONError(w, http.StatusForbidden, "forbidden")
+	writeProblem(w, r, problem{
+		Status: http.StatusForbidden,
+		Code:   codeForbidden,
+		Detail: "you are not allowed to perform this action",
+	})
 }
 
+// badRequestResponse only shows clients errors written for them: JSON
+// errors are rewritten by jsonErrorDetail, validation errors become the
+// per-field errors of the problem and anything it doesn't know gets a
+// generic detail.
 func (app *application) badRequestResponse(w http.ResponseWriter, r *http.Request, err error) {
-	app.logger.Warnf("bad request", "method", r.Method, "path", r.URL.Path, "error", err.Error())
-
-	writeJSONError(w, http.StatusBadRequest, err.Error())
+	app.requestLogger(r).Warnw("bad request", "method", r.Method, "path", r.URL.Path, "error", err.Error())
+
+	p := problem{
+		Status: http.StatusBadRequest,
+		Code:   codeBadRequest,
+		Detail: "the request is malformed",
+	}
+
+	var validationErrs validator.ValidationErrors
+	var queryErr *store.InvalidQueryError
+	var numErr *strconv.NumError
+
+	switch {
+	case errors.As(err, &validationErrs):
+		p.Code = codeValidationFailed
+		p.Detail = "the request failed validation, see errors for the offending fields"
+		p.Errors = fieldErrors(validationErrs)
+	case errors.Is(err, store.ErrDuplicateEmail):
+		p.Code = codeDuplicateEmail
+		p.Detail = err.Error()
+	case errors.Is(err, store.ErrDuplicateUsername):
+		p.Code = codeDuplicateUsername
+		p.Detail = err.Error()
+	case errors.As(err, &queryErr):
+		p.Code = codeInvalidQuery
+		p.Detail = queryErr.Detail
+	case errors.Is(err, errInvalidCursor):
+		p.Code = codeInvalidCursor
+		p.Detail = "the cursor is malformed or from another listing"
+	case errors.Is(err, errFollowSelf):
+		p.Code = codeFollowSelf
+		p.Detail = err.Error()
+	case errors.As(err, &numErr):
+		// path ids are the only numbers parsed outside of the query
+		p.Code = codeInvalidID
+		p.Detail = fmt.Sprintf("invalid id %q: must be an integer", numErr.Num)
+	default:
+		if detail, ok := jsonErrorDetail(err); ok {
+			p.Code = codeInvalidJSON
+			p.Detail = detail
+		}
+	}
+
+	writeProblem(w, r, p)
 }
 
 func (app *application) conflictResponse(w http.ResponseWriter, r *http.Request, err error) {
-	app.logger.Errorf("conflict response", "method", r.Method, "path", r.URL.Path, "error", err.Error())
+	app.requestLogger(r).Warnw("conflict response", "method", r.Method, "path", r.URL.Path, "error", err.Error())
+
+	code := codeConflict
+	if errors.Is(err, store.ErrEditConflict) {
+		code = codeEditConflict
+	}
+
+	writeProblem(w, r, problem{
+		Status: http.StatusConflict,
+		Code:   code,
+		Detail: err.Error(),
+	})
+}
+
+func (app *application) preconditionFailedResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.requestLogger(r).Warnw("precondition failed", "method", r.Method, "path", r.URL.Path, "error", err.Error())
 
-	writeJSONError(w, http.StatusConflict, err.Error())
+	writeProblem(w, r, problem{
+		Status: http.StatusPreconditionFailed,
+		Code:   codePreconditionFailed,
+		Detail: "the resource was modified since it was read",
+	})
 }
 
 func (app *application) notFoundResponse(w http.ResponseWriter, r *http.Request, err error) {
-	app.logger.Warnf("not found error", "method", r.Method, "path", r.URL.Path, "error", err.Error())
+	app.requestLogger(r).Warnw("not found error", "method", r.Method, "path", r.URL.Path, "error", err.Error())
 
-	writeJSONError(w, http.StatusNotFound, "not found")
+	writeProblem(w, r, problem{
+		Status: http.StatusNotFound,
+		Code:   codeNotFound,
+		Detail: "the requested resource could not be found",
+	})
 }
 
 func (app *application) unauthorizedErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
-	app.logger.Warnf("unauthorized error", "method", r.Method, "path", r.URL.Path, "error", err.Error())
+	app.requestLogger(r).Warnw("unauthorized error", "method", r.Method, "path", r.URL.Path, "error", err.Error())
 
-	writeJSONError(w, http.StatusUnauthorized, "unauthorized")
+	writeProblem(w, r, problem{
+		Status: http.StatusUnauthorized,
+		Code:   codeUnauthorized,
+		Detail: "missing or invalid credentials",
+	})
 }
 
 func (app *application) unauthorizedBasicErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
-	app.logger.Warnf("unauthorized basic error", "method", r.Method, "path", r.URL.Path, "error", err.Error())
+	app.requestLogger(r).Warnw("unauthorized basic error", "method", r.Method, "path", r.URL.Path, "error", err.Error())
 
 	w.Header().Set("WWW-Authenticate", `Basic realm="restricted", charset="UTF-8"`)
 
-	writeJSONError(w, http.StatusUnauthorized, "unauthorized")
+	writeProblem(w, r, problem{
+		Status: http.StatusUnauthorized,
+		Code:   codeUnauthorized,
+		Detail: "missing or invalid credentials",
+	})
 }
 
 func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http.Request, retryAfter string) {
-	app.logger.Warnw("rate limit exceeded", "method", r.Method, "path", r.URL.Path)
+	app.requestLogger(r).Warnw("rate limit exceeded", "method", r.Method, "path", r.URL.Path)
 
 	w.Header().Set("Retry-After", retryAfter)
 
-	writeJSONError(w, http.StatusTooManyRequests, "rate limit exceeded, retry after: "+retryAfter)
+	writeProblem(w, r, problem{
+		Status: http.StatusTooManyRequests,
+		Code:   codeRateLimited,
+		Detail: "rate limit exceeded, retry after: " + retryAfter,
+	})
 }
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"database/sql"
+	"expvar"
+	"net/http"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+var (
+	totalRequestsReceived   = expvar.NewInt("total_requests_received")
+	totalResponsesSent      = expvar.NewInt("total_responses_sent")
+	totalProcessingTimeUs   = expvar.NewInt("total_processing_time_us")
+	totalResponsesByStatus  = expvar.NewMap("total_responses_sent_by_status")
+	totalRequestsInProgress = expvar.NewInt("total_requests_in_progress")
+)
+
+// publishExpvars exposes the values that are read on demand rather than
+// counted by ExpvarMiddleware. It must only be called once.
+func publishExpvars(db *sql.DB) {
+	expvar.NewString("version").Set(version)
+	expvar.Publish("goroutines", expvar.Func(func() any {
+		return runtime.NumGoroutine()
+	}))
+	expvar.Publish("database", expvar.Func(func() any {
+		return db.Stats()
+	}))
+}
+
+// ExpvarMiddleware counts requests and responses for /v1/debug/vars.
+func (app *application) ExpvarMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		totalRequestsReceived.Add(1)
+		totalRequestsInProgress.Add(1)
+		defer totalRequestsInProgress.Add(-1)
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		totalResponsesSent.Add(1)
+		totalResponsesByStatus.Add(strconv.Itoa(status), 1)
+		totalProcessingTimeUs.Add(time.Since(start).Microseconds())
+	})
+}
@@ -5,23 +5,32 @@ import (
 	"social/internal/store"
 )
 
+// feedResponse is the feed page along with the cursor of the next one.
+type feedResponse struct {
+	Data       []store.PostWithMetadata `json:"data"`
+	NextCursor string                   `json:"next_cursor,omitempty"`
+}
+
 // getUserFeedHandler godoc
 //
 //	@Summary		Fetches the user feed
-//	@Description	Fetches the user feed
+//	@Description	Fetches the user feed. Pages are walked either with limit/offset or,
+//	@Description	preferably, by passing the next_cursor of a page (also sent in the
+//	@Description	Link header) as the cursor of the next request.
 //	@Tags			feed
 //	@Accept			json
 //	@Produce		json
-//	@Param			since	query		string	false	"Since"
-//	@Param			until	query		string	false	"Until"
+//	@Param			since	query		string	false	"Only posts created at or after, RFC 3339 or 2006-01-02 15:04:05"
+//	@Param			until	query		string	false	"Only posts created at or before, RFC 3339 or 2006-01-02 15:04:05"
 //	@Param			limit	query		int		false	"Limit"
-//	@Param			offset	query		int		false	"Offset"
+//	@Param			offset	query		int		false	"Offset, can't be combined with cursor"
+//	@Param			cursor	query		string	false	"Cursor from a previous page"
 //	@Param			sort	query		string	false	"Sort"
 //	@Param			tags	query		string	false	"Tags"
 //	@Param			search	query		string	false	"Search"
-//	@Success		200		{object}	[]store.PostWithMetadata
-//	@Failure		400		{object}	error
-//	@Failure		500		{object}	error
+//	@Success		200		{object}	feedResponse
+//	@Failure		400		{object}	problem
+//	@Failure		500		{object}	problem
 //	@Security		ApiKeyAuth
 //	@Router			/users/feed [get]
 func (app *application) getUserFeedHandler(w http.ResponseWriter, r *http.Request) {
@@ -44,16 +53,40 @@ func (app *application) getUserFeedHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	if token := r.URL.Query().Get("cursor"); token != "" {
+		if fq.Offset != 0 {
+			app.badRequestResponse(w, r, &store.InvalidQueryError{Detail: "cursor and offset can't be combined"})
+			return
+		}
+
+		after, err := app.decodeCursor(feedCursorScope(fq.Sort), token)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		fq.After = &after
+	}
+
 	ctx := r.Context()
-	// user := getUserFromContext(r)
+	user := getUserFromContext(r)
+
+	feed, err := app.store.Posts.GetUserFeed(ctx, user.ID, fq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	res := feedResponse{Data: feed}
 
-	feed, err := app.store.Posts.GetUserFeed(ctx, int64(1), fq)
+	res.NextCursor, err = nextPage(app, w, r, feedCursorScope(fq.Sort), feed, fq.Limit, func(p store.PostWithMetadata) (string, int64) {
+		return p.CreatedAt, p.ID
+	})
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 
-	if err := app.jsonResponse(w, http.StatusOK, feed); err != nil {
+	if err := writeJSON(w, http.StatusOK, res); err != nil {
 		app.internalServerError(w, r, err)
 	}
 }
@@ -1,10 +1,56 @@
 package main
 
 import (
+	"context"
 	"net/http"
+	"sync"
+	"time"
 )
 
-func (app *application) healthCheckHandler(w http.ResponseWriter, r *http.Request) {
+const healthCheckTimeout = 2 * time.Second
+
+// healthCheck probes one dependency the API can't serve traffic without.
+type healthCheck struct {
+	name  string
+	check func(context.Context) error
+}
+
+// dependencyStatus leaves out why a check failed, the probe is public and
+// errors can name internal hosts. The reason is logged instead.
+type dependencyStatus struct {
+	Status  string `json:"status"`
+	Latency string `json:"latency"`
+}
+
+type dbPoolStats struct {
+	MaxOpenConnections int    `json:"max_open_connections"`
+	OpenConnections    int    `json:"open_connections"`
+	InUse              int    `json:"in_use"`
+	Idle               int    `json:"idle"`
+	WaitCount          int64  `json:"wait_count"`
+	WaitDuration       string `json:"wait_duration"`
+	MaxIdleClosed      int64  `json:"max_idle_closed"`
+	MaxIdleTimeClosed  int64  `json:"max_idle_time_closed"`
+	MaxLifetimeClosed  int64  `json:"max_lifetime_closed"`
+}
+
+type readinessReport struct {
+	Status       string                      `json:"status"`
+	Env          string                      `json:"env"`
+	Version      string                      `json:"version"`
+	Dependencies map[string]dependencyStatus `json:"dependencies"`
+	DBPool       dbPoolStats                 `json:"db_pool"`
+}
+
+// livenessHandler godoc
+//
+//	@Summary		Liveness probe
+//	@Description	Reports whether the process is up, without checking dependencies
+//	@Tags			ops
+//	@Produce		json
+//	@Success		200	{object}	map[string]string
+//	@Router			/health/live [get]
+func (app *application) livenessHandler(w http.ResponseWriter, r *http.Request) {
 	data := map[string]string{
 		"status":  "ok",
 		"env":     app.config.env,
@@ -15,3 +61,89 @@ func (app *application) healthCheckHandler(w http.ResponseWriter, r *http.Reques
 		app.internalServerError(w, r, err)
 	}
 }
+
+// readinessHandler godoc
+//
+//	@Summary		Readiness probe
+//	@Description	Pings every dependency and reports their status, latency and the DB pool stats
+//	@Tags			ops
+//	@Produce		json
+//	@Success		200	{object}	readinessReport
+//	@Failure		503	{object}	readinessReport
+//	@Router			/health/ready [get]
+func (app *application) readinessHandler(w http.ResponseWriter, r *http.Request) {
+	report := readinessReport{
+		Status:       "ok",
+		Env:          app.config.env,
+		Version:      version,
+		Dependencies: app.runHealthChecks(r.Context()),
+	}
+
+	for _, dep := range report.Dependencies {
+		if dep.Status != "ok" {
+			report.Status = "degraded"
+		}
+	}
+
+	if app.db != nil {
+		stats := app.db.Stats()
+		report.DBPool = dbPoolStats{
+			MaxOpenConnections: stats.MaxOpenConnections,
+			OpenConnections:    stats.OpenConnections,
+			InUse:              stats.InUse,
+			Idle:               stats.Idle,
+			WaitCount:          stats.WaitCount,
+			WaitDuration:       stats.WaitDuration.String(),
+			MaxIdleClosed:      stats.MaxIdleClosed,
+			MaxIdleTimeClosed:  stats.MaxIdleTimeClosed,
+			MaxLifetimeClosed:  stats.MaxLifetimeClosed,
+		}
+	}
+
+	status := http.StatusOK
+	if report.Status != "ok" {
+		status = http.StatusServiceUnavailable
+	}
+
+	if err := app.jsonResponse(w, status, report); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// runHealthChecks runs all checks concurrently, each bounded by
+// healthCheckTimeout so a hung dependency can't hold up the probe.
+func (app *application) runHealthChecks(ctx context.Context) map[string]dependencyStatus {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	results := make(map[string]dependencyStatus, len(app.healthChecks))
+
+	for _, hc := range app.healthChecks {
+		wg.Add(1)
+		go func(hc healthCheck) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+			defer cancel()
+
+			start := time.Now()
+			err := hc.check(ctx)
+
+			res := dependencyStatus{
+				Status:  "ok",
+				Latency: time.Since(start).String(),
+			}
+			if err != nil {
+				res.Status = "down"
+				app.logger.Warnw("health check failed", "dependency", hc.name, "error", err.Error())
+			}
+
+			mu.Lock()
+			results[hc.name] = res
+			mu.Unlock()
+		}(hc)
+	}
+
+	wg.Wait()
+
+	return results
+}
@@ -2,7 +2,12 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"reflect"
+	"strings"
 
 	"github.com/go-playground/validator/v10"
 )
@@ -11,6 +16,15 @@ var Validate *validator.Validate
 
 func init() {
 	Validate = validator.New(validator.WithRequiredStructEnabled())
+
+	// report fields by the name clients know them by
+	Validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
 }
 
 // writing JSON responses in HTTP handlers
@@ -43,12 +57,33 @@ func readJSON(w http.ResponseWriter, r *http.Request, data any) error {
 	return decoder.Decode(data)
 }
 
-func writeJSONError(w http.ResponseWriter, status int, message string) error {
-	type envelope struct {
-		Error string `json:"error"`
-	}
+// jsonErrorDetail turns the errors readJSON can return into messages that
+// are safe to show to clients. It reports false for any other error.
+func jsonErrorDetail(err error) (string, bool) {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var maxBytesErr *http.MaxBytesError
 
-	return writeJSON(w, status, &envelope{Error: message})
+	switch {
+	case errors.As(err, &syntaxErr):
+		return fmt.Sprintf("body contains badly-formed JSON (at character %d)", syntaxErr.Offset), true
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return "body contains badly-formed JSON", true
+	case errors.As(err, &typeErr):
+		if typeErr.Field != "" {
+			return fmt.Sprintf("body contains incorrect JSON type for field %q", typeErr.Field), true
+		}
+		return fmt.Sprintf("body contains incorrect JSON type (at character %d)", typeErr.Offset), true
+	case errors.Is(err, io.EOF):
+		return "body must not be empty", true
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field := strings.TrimPrefix(err.Error(), "json: unknown field ")
+		return fmt.Sprintf("body contains unknown field %s", field), true
+	case errors.As(err, &maxBytesErr):
+		return fmt.Sprintf("body must not be larger than %d bytes", maxBytesErr.Limit), true
+	default:
+		return "", false
+	}
 }
 
 func (app *application) jsonResponse(w http.ResponseWriter, status int, data any) error {
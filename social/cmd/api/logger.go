@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// newLogger logs JSON in production and human readable lines everywhere
+// else. level is any zap level name ("debug", "info", "warn", ...).
+func newLogger(env, level string) (*zap.SugaredLogger, error) {
+	cfg := zap.NewDevelopmentConfig()
+	if env == "production" {
+		cfg = zap.NewProductionConfig()
+	}
+
+	lvl, err := zapcore.ParseLevel(level)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Level = zap.NewAtomicLevelAt(lvl)
+
+	logger, err := cfg.Build()
+	if err != nil {
+		return nil, err
+	}
+
+	return logger.Sugar(), nil
+}
+
+// requestLogger is app.logger with the request and trace ids attached, for
+// log lines written while serving r.
+func (app *application) requestLogger(r *http.Request) *zap.SugaredLogger {
+	fields := []any{"request_id", middleware.GetReqID(r.Context())}
+	if id := traceID(r.Context()); id != "" {
+		fields = append(fields, "trace_id", id)
+	}
+
+	return app.logger.With(fields...)
+}
+
+type accessLogKey string
+
+const accessLogCtx accessLogKey = "accessLog"
+
+// accessLogEntry is shared with the handlers further down the chain so they
+// can add what the access log can't see from the outside, like the user.
+type accessLogEntry struct {
+	userID int64
+}
+
+// setAccessLogUser records the authenticated user on the request's access
+// log line.
+func setAccessLogUser(r *http.Request, userID int64) {
+	if entry, ok := r.Context().Value(accessLogCtx).(*accessLogEntry); ok {
+		entry.userID = userID
+	}
+}
+
+// AccessLogMiddleware logs one line per request once it's been served.
+func (app *application) AccessLogMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		entry := &accessLogEntry{}
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		ctx := context.WithValue(r.Context(), accessLogCtx, entry)
+
+		defer func() {
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			fields := []any{
+				"request_id", middleware.GetReqID(ctx),
+				"method", r.Method,
+				"path", r.URL.Path,
+				"remote_addr", r.RemoteAddr,
+				"status", status,
+				"bytes", ww.BytesWritten(),
+				"latency", time.Since(start),
+			}
+			if id := traceID(ctx); id != "" {
+				fields = append(fields, "trace_id", id)
+			}
+			if entry.userID != 0 {
+				fields = append(fields, "user_id", entry.userID)
+			}
+
+			switch {
+			case status >= 500:
+				app.logger.Errorw("request served", fields...)
+			case status >= 400:
+				app.logger.Warnw("request served", fields...)
+			default:
+				app.logger.Infow("request served", fields...)
+			}
+		}()
+
+		next.ServeHTTP(ww, r.WithContext(ctx))
+	})
+}
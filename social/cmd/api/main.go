@@ -1,10 +1,21 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log"
+	"os"
+	"social/cmd/migrate/migrations"
+	"social/internal/auth"
 	"social/internal/db"
 	"social/internal/env"
+	"social/internal/mailer"
+	"social/internal/migrate"
+	"social/internal/ratelimiter"
 	"social/internal/store"
+	"social/internal/store/cache"
+	"strings"
+	"time"
 )
 
 const version = "0.0.1"
@@ -36,7 +47,91 @@ func main() {
 			maxIdleConns: env.GetInt("DB_MAX_IDLE_CONNS", 30),
 			maxIdleTime:  env.GetString("DB_MAX_IDLE_TIME", "15m"),
 		},
-		env: env.GetString("ENV", "development"),
+		env:            env.GetString("ENV", "development"),
+		logLevel:       env.GetString("LOG_LEVEL", "info"),
+		apiURL:         env.GetString("EXTERNAL_URL", "localhost:8080"),
+		frontendURL:    env.GetString("FRONTEND_URL", "http://localhost:5173"),
+		metricsAddr:    env.GetString("METRICS_ADDR", ""),
+		traceExporter:  env.GetString("TRACE_EXPORTER", "none"),
+		cursorSecret:   env.GetString("CURSOR_SECRET", "example"),
+		migrateOnStart: env.GetBool("MIGRATE_ON_START", false),
+		mail: mailConfig{
+			exp:       time.Hour * 24 * 3, // 3 days
+			provider:  env.GetString("MAIL_PROVIDER", "stdout"),
+			fromEmail: env.GetString("FROM_EMAIL", ""),
+			filePath:  env.GetString("MAIL_FILE", "bin/mail.log"),
+			sendGrid: sendGridConfig{
+				apiKey: env.GetString("SENDGRID_API_KEY", ""),
+			},
+			mailTrap: mailTrapConfig{
+				apiKey:  env.GetString("MAILTRAP_API_KEY", ""),
+				inboxID: env.GetString("MAILTRAP_INBOX_ID", ""),
+			},
+			smtp: smtpConfig{
+				host:     env.GetString("SMTP_HOST", "localhost"),
+				port:     env.GetInt("SMTP_PORT", 1025),
+				username: env.GetString("SMTP_USERNAME", ""),
+				password: env.GetString("SMTP_PASSWORD", ""),
+			},
+		},
+		redisCfg: redisConfig{
+			addr:    env.GetString("REDIS_ADDR", "localhost:6379"),
+			pw:      env.GetString("REDIS_PW", ""),
+			db:      env.GetInt("REDIS_DB", 0),
+			enabled: env.GetBool("REDIS_ENABLED", false),
+		},
+		rateLimiter: ratelimiter.Config{
+			Strategy:             env.GetString("RATELIMITER_STRATEGY", ratelimiter.StrategyFixedWindow),
+			RequestsPerTimeFrame: env.GetInt("RATELIMITER_REQUESTS_COUNT", 20),
+			TimeFrame:            env.GetDuration("RATELIMITER_TIMEFRAME", time.Second*5),
+			Enabled:              env.GetBool("RATELIMITER_ENABLED", true),
+		},
+		auth: authConfig{
+			basic: basicConfig{
+				// unset, the endpoints behind basic auth refuse every request
+				user: env.GetString("AUTH_BASIC_USER", ""),
+				pass: env.GetString("AUTH_BASIC_PASS", ""),
+			},
+			token: tokenConfig{
+				secret: env.GetString("AUTH_TOKEN_SECRET", "example"),
+				exp:    time.Hour * 24 * 3, // 3 days
+				iss:    "gophersocial",
+			},
+		},
+	}
+
+	// Logger
+	logger, err := newLogger(cfg.env, cfg.logLevel)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer logger.Sync()
+
+	// Tracing
+	shutdownTracing, err := newTracerProvider(context.Background(), cfg.traceExporter)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := shutdownTracing(ctx); err != nil {
+			logger.Errorw("tracing shutdown failed", "error", err)
+		}
+	}()
+
+	// Route groups can override the global limits, e.g.
+	// RATELIMITER_AUTHENTICATION_REQUESTS_COUNT=5 RATELIMITER_AUTHENTICATION_TIMEFRAME=1m
+	cfg.rateLimiterGroups = make(map[string]ratelimiter.Config)
+	for _, group := range []string{"authentication", "posts", "users"} {
+		if groupCfg, ok := rateLimiterGroupConfig(group, cfg.rateLimiter); ok {
+			cfg.rateLimiterGroups[group] = groupCfg
+		}
+	}
+
+	if cfg.auth.basic.user == "" || cfg.auth.basic.pass == "" {
+		logger.Warn("AUTH_BASIC_USER or AUTH_BASIC_PASS is not set, /v1/debug/vars and /metrics refuse every request")
 	}
 
 	// Main Database
@@ -47,25 +142,153 @@ func main() {
 		cfg.db.maxIdleTime,
 	)
 	if err != nil {
-		log.Panic(err)
+		logger.Fatal(err)
 	}
 	defer db.Close()
-	log.Printf("Database pool connection established")
+	logger.Info("database connection pool established")
+
+	// Replicas starting together take turns, the first one migrates and
+	// the others find nothing left to do
+	if cfg.migrateOnStart {
+		m, err := migrate.New(db, migrations.FS)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		m.Log = logger.Infof
+
+		if err := m.Up(context.Background()); err != nil {
+			logger.Fatal(err)
+		}
+		logger.Info("database migrations applied")
+	}
 
 	store := store.NewPostgresStorage(db)
 
+	healthChecks := []healthCheck{
+		{name: "database", check: db.PingContext},
+	}
+
+	// Cache, falls back to a per-process cache when Redis is disabled
+	cacheStorage := cache.NewInMemoryStorage(cache.UserExpTime)
+	if cfg.redisCfg.enabled {
+		rdb := cache.NewRedisClient(cfg.redisCfg.addr, cfg.redisCfg.pw, cfg.redisCfg.db)
+		defer rdb.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err := rdb.Ping(ctx).Err()
+		cancel()
+		if err != nil {
+			logger.Fatal(err)
+		}
+		logger.Info("redis cache connection established")
+
+		cacheStorage = cache.NewRedisStorage(rdb)
+		healthChecks = append(healthChecks, healthCheck{
+			name:  "cache",
+			check: func(ctx context.Context) error { return rdb.Ping(ctx).Err() },
+		})
+	}
+
+	// Mailer
+	mailer, err := newMailer(cfg.mail)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	if p, ok := mailer.(interface{ Ping(context.Context) error }); ok {
+		healthChecks = append(healthChecks, healthCheck{name: "mail", check: p.Ping})
+	}
+
+	jwtAuthenticator := auth.NewJWTAuthenticator(
+		cfg.auth.token.secret,
+		cfg.auth.token.iss,
+		cfg.auth.token.iss,
+	)
+
+	// Rate limiters
+	rateLimiter, err := ratelimiter.New(cfg.rateLimiter)
+	if err != nil && cfg.rateLimiter.Enabled {
+		logger.Fatal(err)
+	}
+
+	groupRateLimiters := make(map[string]ratelimiter.Limiter, len(cfg.rateLimiterGroups))
+	for group, groupCfg := range cfg.rateLimiterGroups {
+		limiter, err := ratelimiter.New(groupCfg)
+		if err != nil {
+			logger.Fatalw("invalid rate limiter config", "group", group, "error", err.Error())
+		}
+		groupRateLimiters[group] = limiter
+	}
+
 	app := &application{
 		// app configs
 		config: cfg,
 		// how to interact with DB
+		db:    db,
 		store: store,
+		// structured logs, JSON in production
+		logger: logger,
+		// caches hot lookups in front of the DB
+		cacheStorage: cacheStorage,
+		// sends the invitation emails
+		mailer: mailer,
+		// issues and validates the Bearer tokens
+		authenticator: jwtAuthenticator,
+		// throttles callers by user or IP
+		rateLimiter:       rateLimiter,
+		groupRateLimiters: groupRateLimiters,
+		// probed by /health/ready
+		healthChecks: healthChecks,
 	}
 
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go app.purgeExpiredInvitations(ctx, time.Hour)
+	go app.runEmailOutbox(ctx, 5*time.Second)
+
+	// Metrics collected
+	publishExpvars(db)
+
 	mux := app.mount()
-	log.Printf("Starting server...")
 	if err := app.run(mux); err != nil {
-		log.Printf("Server error: %v", err)
-		log.Fatal(err)
+		logger.Fatal(err)
+	}
+}
+
+// rateLimiterGroupConfig reads the RATELIMITER_<GROUP>_* overrides on top of
+// base. A group only gets its own limiter when its request count is set.
+func rateLimiterGroupConfig(group string, base ratelimiter.Config) (ratelimiter.Config, bool) {
+	prefix := "RATELIMITER_" + strings.ToUpper(group) + "_"
+
+	requests := env.GetInt(prefix+"REQUESTS_COUNT", 0)
+	if requests <= 0 {
+		return ratelimiter.Config{}, false
+	}
+
+	return ratelimiter.Config{
+		Strategy:             env.GetString(prefix+"STRATEGY", base.Strategy),
+		RequestsPerTimeFrame: requests,
+		TimeFrame:            env.GetDuration(prefix+"TIMEFRAME", base.TimeFrame),
+		Enabled:              true,
+	}, true
+}
+
+func newMailer(cfg mailConfig) (mailer.Client, error) {
+	switch cfg.provider {
+	case "sendgrid":
+		return mailer.NewSendgrid(cfg.sendGrid.apiKey, cfg.fromEmail), nil
+	case "mailtrap":
+		return mailer.NewMailTrap(cfg.mailTrap.apiKey, cfg.fromEmail, cfg.mailTrap.inboxID), nil
+	case "smtp":
+		return mailer.NewSMTP(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.fromEmail), nil
+	case "file":
+		f, err := os.OpenFile(cfg.filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			return nil, err
+		}
+		return mailer.NewWriterMailer(f, cfg.fromEmail), nil
+	case "stdout":
+		return mailer.NewWriterMailer(os.Stdout, cfg.fromEmail), nil
+	default:
+		return nil, fmt.Errorf("unknown mail provider %q", cfg.provider)
 	}
-	log.Printf("Server stopped gracefully")
 }
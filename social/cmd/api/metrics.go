@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	httpRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "social",
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "HTTP requests handled, labelled by method, route pattern and status.",
+	}, []string{"method", "route", "status"})
+
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "social",
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Time spent handling HTTP requests, labelled by method, route pattern and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	// alert on any increase, the recipient never got the email
+	outboxEmailsFailed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "social",
+		Subsystem: "email_outbox",
+		Name:      "failed_total",
+		Help:      "Outbox emails given up on, labelled by template.",
+	}, []string{"template"})
+)
+
+// MetricsMiddleware records every request in the Prometheus HTTP metrics.
+// Requests are labelled with the chi route pattern (/v1/posts/{postID}/)
+// rather than the raw path, so ids don't blow up the label cardinality.
+func (app *application) MetricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		// the pattern is only complete once the router has matched the
+		// request, that is after next returns
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+
+		labels := prometheus.Labels{
+			"method": r.Method,
+			"route":  route,
+			"status": strconv.Itoa(status),
+		}
+		httpRequestsTotal.With(labels).Inc()
+		httpRequestDuration.With(labels).Observe(time.Since(start).Seconds())
+	})
+}
+
+// newMetricsServer serves /metrics on its own address, so it can be kept
+// off the public listener.
+func newMetricsServer(addr string) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", promhttp.Handler())
+
+	return &http.Server{
+		Addr:         addr,
+		Handler:      mux,
+		WriteTimeout: time.Second * 30,
+		ReadTimeout:  time.Second * 10,
+		IdleTimeout:  time.Minute,
+	}
+}
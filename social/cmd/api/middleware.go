@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"social/internal/ratelimiter"
+	"social/internal/store"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// BasicAuthMiddleware protects operational endpoints with the credentials
+// from authConfig.basic. Both values are hashed before the constant time
+// comparison so their length doesn't leak either. Without credentials
+// configured every request is refused.
+func (app *application) BasicAuthMiddleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if app.config.auth.basic.user == "" || app.config.auth.basic.pass == "" {
+				app.unauthorizedBasicErrorResponse(w, r, fmt.Errorf("basic auth credentials are not configured"))
+				return
+			}
+
+			username, password, ok := r.BasicAuth()
+			if !ok {
+				app.unauthorizedBasicErrorResponse(w, r, fmt.Errorf("authorization header is missing or malformed"))
+				return
+			}
+
+			usernameHash := sha256.Sum256([]byte(username))
+			passwordHash := sha256.Sum256([]byte(password))
+			expectedUsernameHash := sha256.Sum256([]byte(app.config.auth.basic.user))
+			expectedPasswordHash := sha256.Sum256([]byte(app.config.auth.basic.pass))
+
+			usernameMatch := subtle.ConstantTimeCompare(usernameHash[:], expectedUsernameHash[:]) == 1
+			passwordMatch := subtle.ConstantTimeCompare(passwordHash[:], expectedPasswordHash[:]) == 1
+
+			if !usernameMatch || !passwordMatch {
+				app.unauthorizedBasicErrorResponse(w, r, fmt.Errorf("invalid credentials"))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (app *application) AuthTokenMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authHeader := r.Header.Get("Authorization")
+		if authHeader == "" {
+			app.unauthorizedErrorResponse(w, r, fmt.Errorf("authorization header is missing"))
+			return
+		}
+
+		parts := strings.Split(authHeader, " ")
+		if len(parts) != 2 || parts[0] != "Bearer" {
+			app.unauthorizedErrorResponse(w, r, fmt.Errorf("authorization header is malformed"))
+			return
+		}
+
+		token := parts[1]
+		jwtToken, err := app.authenticator.ValidateToken(token)
+		if err != nil {
+			app.unauthorizedErrorResponse(w, r, err)
+			return
+		}
+
+		claims, _ := jwtToken.Claims.(jwt.MapClaims)
+
+		userID, err := strconv.ParseInt(fmt.Sprintf("%.f", claims["sub"]), 10, 64)
+		if err != nil {
+			app.unauthorizedErrorResponse(w, r, err)
+			return
+		}
+
+		ctx := r.Context()
+
+		user, err := app.getUser(ctx, userID)
+		if err != nil {
+			switch err {
+			case store.ErrNotFound:
+				app.unauthorizedErrorResponse(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+
+		setAccessLogUser(r, user.ID)
+
+		ctx = context.WithValue(ctx, userCtx, user)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// checkPostOwnership lets the post's author through, as well as anyone whose
+// role is at least as high as requiredRole.
+func (app *application) checkPostOwnership(requiredRole string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := getUserFromContext(r)
+		post := getPostFromCtx(r)
+
+		if post.UserID == user.ID {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		allowed, err := app.checkRolePrecedence(r.Context(), user, requiredRole)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		if !allowed {
+			app.forbiddenResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
+
+// checkCommentOwnership lets the author of the comment through, and anyone
+// else whose role is at least requiredRole.
+func (app *application) checkCommentOwnership(requiredRole string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := getUserFromContext(r)
+		comment := getCommentFromCtx(r)
+
+		if comment.UserID == user.ID {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		allowed, err := app.checkRolePrecedence(r.Context(), user, requiredRole)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		if !allowed {
+			app.forbiddenResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
+
+func (app *application) checkRolePrecedence(ctx context.Context, user *store.User, roleName string) (bool, error) {
+	role, err := app.store.Roles.GetByName(ctx, roleName)
+	if err != nil {
+		return false, err
+	}
+
+	return user.Role.Level >= role.Level, nil
+}
+
+// RateLimiterMiddleware applies the global limiter. It runs before any
+// authentication, so callers are told apart by IP only.
+func (app *application) RateLimiterMiddleware(next http.Handler) http.Handler {
+	return app.rateLimit(app.rateLimiter)(next)
+}
+
+// groupRateLimiterMiddleware applies the limiter configured for a route
+// group, if any. Mounted after AuthTokenMiddleware it limits per user.
+func (app *application) groupRateLimiterMiddleware(group string) func(http.Handler) http.Handler {
+	limiter, ok := app.groupRateLimiters[group]
+	if !ok {
+		return func(next http.Handler) http.Handler { return next }
+	}
+
+	return app.rateLimit(limiter)
+}
+
+func (app *application) rateLimit(limiter ratelimiter.Limiter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			res := limiter.Allow(rateLimitKey(r))
+
+			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(res.Limit))
+			w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			w.Header().Set("X-RateLimit-Reset", ceilSeconds(res.Reset))
+
+			if !res.Allowed {
+				app.rateLimitExceededResponse(w, r, ceilSeconds(res.RetryAfter))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// rateLimitKey identifies the caller by user ID once authenticated and by
+// the client IP (as set by middleware.RealIP) otherwise.
+func rateLimitKey(r *http.Request) string {
+	if user := getUserFromContext(r); user != nil {
+		return "user:" + strconv.FormatInt(user.ID, 10)
+	}
+
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+
+	return "ip:" + ip
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
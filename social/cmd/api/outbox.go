@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"social/internal/mailer"
+	"social/internal/store"
+	"strconv"
+	"time"
+)
+
+// outboxLease is how long a claimed email is kept from other workers. It has
+// to outlast a send, the HTTP mailers give up after 10 seconds.
+const outboxLease = time.Minute
+
+// runEmailOutbox drains the email outbox through the mailer, checking for
+// new emails every interval. It returns once ctx is cancelled.
+func (app *application) runEmailOutbox(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			app.drainEmailOutbox(ctx)
+		}
+	}
+}
+
+func (app *application) drainEmailOutbox(ctx context.Context) {
+	for ctx.Err() == nil {
+		email, err := app.store.Outbox.Claim(ctx, outboxLease)
+		if err != nil {
+			if !errors.Is(err, store.ErrNotFound) {
+				app.logger.Errorw("error claiming outbox email", "error", err.Error())
+			}
+			return
+		}
+
+		if err := app.deliverOutboxEmail(ctx, email); err != nil {
+			app.logger.Errorw("error recording outbox email delivery", "id", email.ID, "error", err.Error())
+			return
+		}
+	}
+}
+
+// deliverOutboxEmail makes a single attempt at sending a claimed email, the
+// outbox schedules the retries. The outbox id is the idempotency key, so a
+// provider can drop the copy sent again after a crash.
+func (app *application) deliverOutboxEmail(ctx context.Context, email *store.OutboxEmail) error {
+	var data map[string]any
+	sendErr := json.Unmarshal(email.Data, &data)
+	// data that doesn't parse won't parse on the next attempt either
+	permanent := sendErr != nil
+
+	if sendErr == nil {
+		isSandbox := app.config.env != "production"
+		key := "outbox-" + strconv.FormatInt(email.ID, 10)
+
+		sendErr = app.mailer.SendOnce(key, email.Template, email.RecipientName, email.RecipientEmail, data, isSandbox)
+		permanent = mailer.IsPermanent(sendErr)
+	}
+
+	if sendErr == nil {
+		return app.store.Outbox.MarkSent(ctx, email.ID)
+	}
+
+	failed, err := app.store.Outbox.MarkAttemptFailed(ctx, email, sendErr, permanent)
+	if err != nil {
+		return err
+	}
+
+	if failed {
+		outboxEmailsFailed.WithLabelValues(email.Template).Inc()
+		app.logger.Errorw("gave up on outbox email",
+			"id", email.ID,
+			"user_id", email.UserID,
+			"template", email.Template,
+			"attempts", email.Attempts,
+			"error", sendErr.Error(),
+		)
+		return nil
+	}
+
+	app.logger.Warnw("error sending outbox email", "id", email.ID, "attempt", email.Attempts, "error", sendErr.Error())
+
+	return nil
+}
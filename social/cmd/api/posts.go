@@ -3,9 +3,13 @@ package main
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
+	"path"
 	"social/internal/store"
 	"strconv"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 )
@@ -29,9 +33,9 @@ type CreatePostPayload struct {
 //	@Produce		json
 //	@Param			payload	body		CreatePostPayload	true	"Post payload"
 //	@Success		201		{object}	store.Post
-//	@Failure		400		{object}	error
-//	@Failure		401		{object}	error
-//	@Failure		500		{object}	error
+//	@Failure		400		{object}	problem
+//	@Failure		401		{object}	problem
+//	@Failure		500		{object}	problem
 //	@Security		ApiKeyAuth
 //	@Router			/posts [post]
 func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request) {
@@ -46,14 +50,13 @@ func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	// user := getUserFromContext(r)
+	user := getUserFromContext(r)
 
 	post := &store.Post{
 		Title:   payload.Title,
 		Content: payload.Content,
 		Tags:    payload.Tags,
-		// UserID:  user.ID,
-		UserID: 1, // TODO: replace with actual user from auth
+		UserID:  user.ID,
 	}
 
 	ctx := r.Context()
@@ -69,31 +72,72 @@ func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request
 	}
 }
 
+// embeddedCommentsLimit is how many comments come with a post, the rest
+// are listed from its comments endpoint.
+const embeddedCommentsLimit = 10
+
+// postResponse is a post with the first page of its top level comments.
+type postResponse struct {
+	*store.Post
+	CommentsCount int `json:"comments_count"`
+	// link to the next page of comments, if there is one
+	CommentsNext string `json:"comments_next,omitempty"`
+}
+
 // GetPost godoc
 //
 //	@Summary		Fetches a post
-//	@Description	Fetches a post by ID
+//	@Description	Fetches a post by ID along with its first top level comments.
+//	@Description	comments_count counts all of its comments and comments_next links to the
+//	@Description	next page of them.
 //	@Tags			posts
 //	@Accept			json
 //	@Produce		json
 //	@Param			id	path		int	true	"Post ID"
-//	@Success		200	{object}	store.Post
-//	@Failure		404	{object}	error
-//	@Failure		500	{object}	error
+//	@Success		200	{object}	postResponse
+//	@Failure		400	{object}	problem
+//	@Failure		404	{object}	problem
+//	@Failure		500	{object}	problem
 //	@Security		ApiKeyAuth
 //	@Router			/posts/{id} [get]
 func (app *application) getPostHandler(w http.ResponseWriter, r *http.Request) {
 	post := getPostFromCtx(r)
+	ctx := r.Context()
+
+	comments, err := app.store.Comments.GetByPostID(ctx, post.ID, store.PaginatedCommentsQuery{Limit: embeddedCommentsLimit})
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
 
-	comments, err := app.store.Comments.GetByPostID(r.Context(), post.ID)
+	count, err := app.store.Comments.CountByPostID(ctx, post.ID)
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 
 	post.Comments = comments
+	res := postResponse{Post: post, CommentsCount: count}
 
-	if err := app.jsonResponse(w, http.StatusOK, post); err != nil {
+	if len(comments) == embeddedCommentsLimit {
+		last := comments[len(comments)-1]
+
+		cursor, err := app.nextCursor(commentsCursorScope(post.ID, nil), last.CreatedAt, last.ID)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		next := url.URL{
+			Path:     path.Join(r.URL.Path, "comments"),
+			RawQuery: url.Values{"cursor": {cursor}}.Encode(),
+		}
+		res.CommentsNext = next.String()
+	}
+
+	w.Header().Set("ETag", postETag(post.Version))
+
+	if err := app.jsonResponse(w, http.StatusOK, res); err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
@@ -108,15 +152,16 @@ func (app *application) getPostHandler(w http.ResponseWriter, r *http.Request) {
 //	@Produce		json
 //	@Param			id	path		int	true	"Post ID"
 //	@Success		204	{object} string
-//	@Failure		404	{object}	error
-//	@Failure		500	{object}	error
+//	@Failure		400	{object}	problem
+//	@Failure		404	{object}	problem
+//	@Failure		500	{object}	problem
 //	@Security		ApiKeyAuth
 //	@Router			/posts/{id} [delete]
 func (app *application) deletePostHandler(w http.ResponseWriter, r *http.Request) {
 	idParam := chi.URLParam(r, "postID")
 	id, err := strconv.ParseInt(idParam, 10, 64)
 	if err != nil {
-		app.internalServerError(w, r, err)
+		app.badRequestResponse(w, r, err)
 		return
 	}
 
@@ -147,18 +192,26 @@ type UpdatePostPayload struct {
 //	@Tags			posts
 //	@Accept			json
 //	@Produce		json
-//	@Param			id		path		int					true	"Post ID"
-//	@Param			payload	body		UpdatePostPayload	true	"Post payload"
-//	@Success		200		{object}	store.Post
-//	@Failure		400		{object}	error
-//	@Failure		401		{object}	error
-//	@Failure		404		{object}	error
-//	@Failure		500		{object}	error
+//	@Param			id			path		int					true	"Post ID"
+//	@Param			If-Match	header		string				false	"Post version as an ETag"
+//	@Param			payload		body		UpdatePostPayload	true	"Post payload"
+//	@Success		200			{object}	store.Post
+//	@Failure		400			{object}	problem
+//	@Failure		401			{object}	problem
+//	@Failure		404			{object}	problem
+//	@Failure		409			{object}	problem
+//	@Failure		412			{object}	problem
+//	@Failure		500			{object}	problem
 //	@Security		ApiKeyAuth
 //	@Router			/posts/{id} [patch]
 func (app *application) updatePostHandler(w http.ResponseWriter, r *http.Request) {
 	post := getPostFromCtx(r)
 
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" && !etagMatches(ifMatch, post.Version) {
+		app.preconditionFailedResponse(w, r, fmt.Errorf("post %d is at version %d", post.ID, post.Version))
+		return
+	}
+
 	var payload UpdatePostPayload
 
 	if err := readJSON(w, r, &payload); err != nil {
@@ -178,24 +231,102 @@ func (app *application) updatePostHandler(w http.ResponseWriter, r *http.Request
 		post.Title = *payload.Title
 	}
 
-	if err := app.store.Posts.Update(r.Context(), post); err != nil {
+	ctx := r.Context()
+
+	if err := app.updatePost(ctx, post); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		case errors.Is(err, store.ErrEditConflict):
+			app.conflictResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.Header().Set("ETag", postETag(post.Version))
+
+	if err := app.jsonResponse(w, http.StatusOK, post); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// SearchPosts godoc
+//
+//	@Summary		Searches posts
+//	@Description	Full-text search over post titles and content, best matches first.
+//	@Description	All words must match, "quoted words" must appear in that order and
+//	@Description	a trailing * matches as a prefix. Matches are wrapped in <mark> tags
+//	@Description	in title_highlight and snippet, which are otherwise HTML escaped.
+//	@Tags			posts
+//	@Produce		json
+//	@Param			q		query		string	true	"Search query"
+//	@Param			limit	query		int		false	"Limit"
+//	@Param			offset	query		int		false	"Offset"
+//	@Success		200		{object}	[]store.PostSearchResult
+//	@Failure		400		{object}	problem
+//	@Failure		401		{object}	problem
+//	@Failure		500		{object}	problem
+//	@Security		ApiKeyAuth
+//	@Router			/posts/search [get]
+func (app *application) searchPostsHandler(w http.ResponseWriter, r *http.Request) {
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if q == "" {
+		app.badRequestResponse(w, r, &store.InvalidQueryError{Detail: "q is required"})
+		return
+	}
+
+	if len(q) > 100 {
+		app.badRequestResponse(w, r, &store.InvalidQueryError{Detail: "q must be at most 100 characters long"})
+		return
+	}
+
+	pg, err := store.PaginatedQuery{Limit: 20, Offset: 0}.Parse(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(pg); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	results, err := app.store.Posts.Search(r.Context(), q, pg)
+	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 
-	if err := writeJSON(w, http.StatusOK, post); err != nil {
+	if err := app.jsonResponse(w, http.StatusOK, results); err != nil {
 		app.internalServerError(w, r, err)
 	}
-	//
-	// ctx := r.Context()
-	//
-	// if err := app.updatePost(ctx, post); err != nil {
-	// 	app.internalServerError(w, r, err)
-	// }
-	//
-	// if err := app.jsonResponse(w, http.StatusOK, post); err != nil {
-	// 	app.internalServerError(w, r, err)
-	// }
+}
+
+// postETag uses the optimistic locking version as the entity tag, so a
+// client can send it back in If-Match to make an update conditional.
+func postETag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// etagMatches reports whether any of the comma separated tags in an If-Match
+// header matches the given version. Weak tags are compared by value.
+func etagMatches(header string, version int) bool {
+	current := postETag(version)
+
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return true
+		}
+
+		if strings.TrimPrefix(tag, "W/") == current {
+			return true
+		}
+	}
+
+	return false
 }
 
 func (app *application) postsContextMiddleware(next http.Handler) http.Handler {
@@ -203,7 +334,7 @@ func (app *application) postsContextMiddleware(next http.Handler) http.Handler {
 		idParam := chi.URLParam(r, "postID")
 		id, err := strconv.ParseInt(idParam, 10, 64)
 		if err != nil {
-			app.internalServerError(w, r, err)
+			app.badRequestResponse(w, r, err)
 			return
 		}
 
@@ -230,11 +361,11 @@ func getPostFromCtx(r *http.Request) *store.Post {
 	return post
 }
 
-// func (app *application) updatePost(ctx context.Context, post *store.Post) error {
-// 	if err := app.store.Posts.Update(ctx, post); err != nil {
-// 		return err
-// 	}
-//
-// 	// app.cacheStorage.Users.Delete(ctx, post.UserID)
-// 	return nil
-// }
+func (app *application) updatePost(ctx context.Context, post *store.Post) error {
+	if err := app.store.Posts.Update(ctx, post); err != nil {
+		return err
+	}
+
+	app.cacheStorage.Users.Delete(ctx, post.UserID)
+	return nil
+}
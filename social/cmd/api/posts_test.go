@@ -0,0 +1,34 @@
+package main
+
+import "testing"
+
+func TestEtagMatches(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   bool
+	}{
+		{name: "strong", header: `"3"`, want: true},
+		{name: "weak", header: `W/"3"`, want: true},
+		{name: "list", header: `"1", "2", "3"`, want: true},
+		{name: "list without spaces", header: `"1","3"`, want: true},
+		{name: "weak in a list", header: `"1", W/"3"`, want: true},
+		{name: "any", header: `*`, want: true},
+		{name: "any in a list", header: `"1", *`, want: true},
+		{name: "other version", header: `"4"`, want: false},
+		{name: "other weak version", header: `W/"4"`, want: false},
+		{name: "none in the list", header: `"1", "2"`, want: false},
+		{name: "unquoted", header: `3`, want: false},
+		{name: "lowercase weak prefix", header: `w/"3"`, want: false},
+		{name: "prefix of the version", header: `"33"`, want: false},
+		{name: "empty", header: ``, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := etagMatches(tt.header, 3); got != tt.want {
+				t.Errorf("etagMatches(%q, 3) = %v, want %v", tt.header, got, tt.want)
+			}
+		})
+	}
+}
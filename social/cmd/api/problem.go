@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-playground/validator/v10"
+)
+
+// problem is an RFC 7807 problem details object. Problems are told apart
+// by Code rather than Type, which is always about:blank.
+type problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	// extension members
+	Code    string       `json:"code"`
+	TraceID string       `json:"trace_id,omitempty"`
+	Errors  []fieldError `json:"errors,omitempty"`
+}
+
+// fieldError is a single failed validation rule. Field is the name of the
+// request body field or query parameter.
+type fieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Param   string `json:"param,omitempty"`
+	Message string `json:"message"`
+}
+
+// writeProblem fills in what p can derive from the request, the request id
+// as the instance and the trace id, and writes it as application/problem+json.
+func writeProblem(w http.ResponseWriter, r *http.Request, p problem) error {
+	p.Type = "about:blank"
+	p.Title = http.StatusText(p.Status)
+	p.Instance = middleware.GetReqID(r.Context())
+	p.TraceID = traceID(r.Context())
+
+	w.Header().Set("content-type", "application/problem+json")
+	w.WriteHeader(p.Status)
+
+	return json.NewEncoder(w).Encode(p)
+}
+
+// fieldErrors translates validator errors. Validate reports fields by
+// their json name, see the tag name func registered in json.go.
+func fieldErrors(errs validator.ValidationErrors) []fieldError {
+	fields := make([]fieldError, 0, len(errs))
+	for _, fe := range errs {
+		fields = append(fields, fieldError{
+			Field:   fe.Field(),
+			Rule:    fe.Tag(),
+			Param:   fe.Param(),
+			Message: validationMessage(fe),
+		})
+	}
+
+	return fields
+}
+
+func validationMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "min":
+		if isCollection(fe.Kind()) {
+			return fmt.Sprintf("must have at least %s items", fe.Param())
+		}
+		return fmt.Sprintf("must be at least %s characters long", fe.Param())
+	case "max":
+		if isCollection(fe.Kind()) {
+			return fmt.Sprintf("must have at most %s items", fe.Param())
+		}
+		return fmt.Sprintf("must be at most %s characters long", fe.Param())
+	case "gte":
+		return fmt.Sprintf("must be greater than or equal to %s", fe.Param())
+	case "lte":
+		return fmt.Sprintf("must be less than or equal to %s", fe.Param())
+	case "oneof":
+		return fmt.Sprintf("must be one of: %s", fe.Param())
+	default:
+		return fmt.Sprintf("failed the %s rule", fe.Tag())
+	}
+}
+
+func isCollection(kind reflect.Kind) bool {
+	return kind == reflect.Slice || kind == reflect.Array || kind == reflect.Map
+}
@@ -1,58 +1,394 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"social/internal/store"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
 )
 
 type userKey string
 
 const userCtx userKey = "user"
 
-// TODO: Implement user handlers when required interfaces are ready
-
-// // GetUser godoc
-// //
-// //	@Summary		Fetches a user profile
-// //	@Description	Fetches a user profile by ID
-// //	@Tags			users
-// //	@Accept			json
-// //	@Produce		json
-// //	@Param			id	path		int	true	"User ID"
-// //	@Success		200	{object}	store.User
-// //	@Failure		400	{object}	error
-// //	@Failure		404	{object}	error
-// //	@Failure		500	{object}	error
-// //	@Security		ApiKeyAuth
-// //	@Router			/users/{id} [get]
-// func (app *application) getUserHandler(w http.ResponseWriter, r *http.Request) {
-// 	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
-// 	if err != nil {
-// 		app.badRequestResponse(w, r, err)
-// 		return
-// 	}
+var errFollowSelf = errors.New("you can't follow yourself")
+
+// userProfile is the public view of a user. The pointer fields are private
+// and only filled in when the caller is the user itself or an admin.
+type userProfile struct {
+	ID             int64       `json:"id"`
+	Username       string      `json:"username"`
+	CreatedAt      string      `json:"created_at"`
+	FollowersCount int64       `json:"followers_count"`
+	FollowingCount int64       `json:"following_count"`
+	Email          *string     `json:"email,omitempty"`
+	IsActive       *bool       `json:"is_active,omitempty"`
+	Role           *store.Role `json:"role,omitempty"`
+}
+
+// GetUser godoc
+//
+//	@Summary		Fetches a user profile
+//	@Description	Fetches a user profile by ID
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			id	path		int	true	"User ID"
+//	@Success		200	{object}	userProfile
+//	@Failure		400	{object}	problem
+//	@Failure		404	{object}	problem
+//	@Failure		500	{object}	problem
+//	@Security		ApiKeyAuth
+//	@Router			/users/{id} [get]
+func (app *application) getUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user, err := app.getUser(r.Context(), userID)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+			return
+		default:
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	app.userProfileResponse(w, r, user)
+}
+
+// GetUserByUsername godoc
+//
+//	@Summary		Fetches a user profile
+//	@Description	Fetches a user profile by username
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			name	path		string	true	"Username"
+//	@Success		200		{object}	userProfile
+//	@Failure		404		{object}	problem
+//	@Failure		500		{object}	problem
+//	@Security		ApiKeyAuth
+//	@Router			/users/by-username/{name} [get]
+func (app *application) getUserByUsernameHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := app.getUserByUsername(r.Context(), chi.URLParam(r, "name"))
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.userProfileResponse(w, r, user)
+}
+
+func (app *application) userProfileResponse(w http.ResponseWriter, r *http.Request, user *store.User) {
+	ctx := r.Context()
+
+	followers, following, err := app.store.Followers.Counts(ctx, user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	profile := userProfile{
+		ID:             user.ID,
+		Username:       user.Username,
+		CreatedAt:      user.CreatedAt,
+		FollowersCount: followers,
+		FollowingCount: following,
+	}
+
+	viewer := getUserFromContext(r)
+
+	private := viewer.ID == user.ID
+	if !private {
+		private, err = app.checkRolePrecedence(ctx, viewer, "admin")
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	if private {
+		profile.Email = &user.Email
+		profile.IsActive = &user.IsActive
+		profile.Role = &user.Role
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, profile); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// FollowUser godoc
+//
+//	@Summary		Follows a user
+//	@Description	Follows a user by ID
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			userID	path		int		true	"User ID"
+//	@Success		204		{string}	string	"User followed"
+//	@Failure		400		{object}	problem	"User payload missing"
+//	@Failure		404		{object}	problem	"User not found"
+//	@Failure		409		{object}	problem	"Already following"
+//	@Security		ApiKeyAuth
+//	@Router			/users/{userID}/follow [put]
+func (app *application) followUserHandler(w http.ResponseWriter, r *http.Request) {
+	followerUser := getUserFromContext(r)
+
+	followedID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if followedID == followerUser.ID {
+		app.badRequestResponse(w, r, errFollowSelf)
+		return
+	}
+
+	if err := app.store.Followers.Follow(r.Context(), followerUser.ID, followedID); err != nil {
+		switch err {
+		case store.ErrConflict:
+			app.conflictResponse(w, r, err)
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// UnfollowUser godoc
+//
+//	@Summary		Unfollow a user
+//	@Description	Unfollow a user by ID
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			userID	path		int		true	"User ID"
+//	@Success		204		{string}	string	"User unfollowed"
+//	@Failure		400		{object}	problem	"User payload missing"
+//	@Failure		404		{object}	problem	"Not following"
+//	@Security		ApiKeyAuth
+//	@Router			/users/{userID}/unfollow [put]
+func (app *application) unfollowUserHandler(w http.ResponseWriter, r *http.Request) {
+	followerUser := getUserFromContext(r)
+
+	unfollowedID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := app.store.Followers.Unfollow(r.Context(), followerUser.ID, unfollowedID); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListFollowers godoc
+//
+//	@Summary		Lists a user's followers
+//	@Description	Lists the users following a user, newest first
+//	@Tags			users
+//	@Produce		json
+//	@Param			userID	path		int	true	"User ID"
+//	@Param			limit	query		int	false	"Limit"
+//	@Param			offset	query		int	false	"Offset"
+//	@Success		200		{object}	[]store.Follower
+//	@Failure		400		{object}	problem
+//	@Failure		500		{object}	problem
+//	@Security		ApiKeyAuth
+//	@Router			/users/{userID}/followers [get]
+func (app *application) listFollowersHandler(w http.ResponseWriter, r *http.Request) {
+	app.listFollows(w, r, app.store.Followers.ListFollowers)
+}
+
+// ListFollowing godoc
 //
-// 	user, err := app.getUser(r.Context(), userID)
-// 	if err != nil {
-// 		switch err {
-// 		case store.ErrNotFound:
-// 			app.notFoundResponse(w, r, err)
-// 			return
-// 		default:
-// 			app.internalServerError(w, r, err)
-// 			return
-// 		}
-// 	}
+//	@Summary		Lists who a user follows
+//	@Description	Lists the users a user follows, newest first
+//	@Tags			users
+//	@Produce		json
+//	@Param			userID	path		int	true	"User ID"
+//	@Param			limit	query		int	false	"Limit"
+//	@Param			offset	query		int	false	"Offset"
+//	@Success		200		{object}	[]store.Follower
+//	@Failure		400		{object}	problem
+//	@Failure		500		{object}	problem
+//	@Security		ApiKeyAuth
+//	@Router			/users/{userID}/following [get]
+func (app *application) listFollowingHandler(w http.ResponseWriter, r *http.Request) {
+	app.listFollows(w, r, app.store.Followers.ListFollowing)
+}
+
+func (app *application) listFollows(
+	w http.ResponseWriter,
+	r *http.Request,
+	list func(context.Context, int64, store.PaginatedQuery) ([]store.Follower, error),
+) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	q, err := store.PaginatedQuery{Limit: 20, Offset: 0}.Parse(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(q); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	follows, err := list(r.Context(), userID, q)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, follows); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// ActivateUser godoc
 //
-// 	if err := app.jsonResponse(w, http.StatusOK, user); err != nil {
-// 		app.internalServerError(w, r, err)
-// 	}
-// }
-
-// TODO: Implement follow/unfollow functionality
-// // FollowUser godoc
-// // UnfollowUser godoc  
-// // ActivateUser godoc
+//	@Summary		Activates/Register a user
+//	@Description	Activates/Register a user by invitation token
+//	@Tags			users
+//	@Produce		json
+//	@Param			token	path		string	true	"Invitation token"
+//	@Success		204		{string}	string	"User activated"
+//	@Failure		404		{object}	problem
+//	@Failure		500		{object}	problem
+//	@Router			/users/activate/{token} [put]
+func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Request) {
+	token := chi.URLParam(r, "token")
+	ctx := r.Context()
+
+	userID, err := app.store.Users.Activate(ctx, token)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	// the cached copy still says the user is inactive
+	app.cacheStorage.Users.Delete(ctx, userID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// purgeExpiredInvitations periodically removes invitations nobody used in
+// time. It returns once ctx is cancelled.
+func (app *application) purgeExpiredInvitations(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := app.store.Users.DeleteExpiredInvitations(ctx)
+			if err != nil {
+				app.logger.Errorw("error purging expired invitations", "error", err.Error())
+				continue
+			}
+			if n > 0 {
+				app.logger.Infow("purged expired invitations", "count", n)
+			}
+		}
+	}
+}
+
+// getUser reads through the cache. Cache failures are logged and treated as
+// a miss so an unavailable cache degrades to hitting the database.
+func (app *application) getUser(ctx context.Context, userID int64) (*store.User, error) {
+	user, err := app.cacheStorage.Users.Get(ctx, userID)
+	if err != nil {
+		app.logger.Warnw("error reading user from cache", "user_id", userID, "error", err.Error())
+	}
+
+	if user != nil {
+		return user, nil
+	}
+
+	user, err = app.store.Users.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := app.cacheStorage.Users.Set(ctx, user); err != nil {
+		app.logger.Warnw("error caching user", "user_id", userID, "error", err.Error())
+	}
+
+	return user, nil
+}
+
+// getUserByUsername reads through the cache like getUser. The cached
+// username to id mapping can be stale, so the user it leads to is only
+// trusted when it still has that username.
+func (app *application) getUserByUsername(ctx context.Context, username string) (*store.User, error) {
+	userID, err := app.cacheStorage.Users.GetIDByUsername(ctx, username)
+	if err != nil {
+		app.logger.Warnw("error reading username from cache", "username", username, "error", err.Error())
+	}
+
+	if userID != 0 {
+		user, err := app.getUser(ctx, userID)
+		switch {
+		case err == nil && user.Username == username:
+			return user, nil
+		case err != nil && !errors.Is(err, store.ErrNotFound):
+			return nil, err
+		}
+	}
+
+	user, err := app.store.Users.GetByUsername(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := app.cacheStorage.Users.Set(ctx, user); err != nil {
+		app.logger.Warnw("error caching user", "user_id", user.ID, "error", err.Error())
+	}
+
+	return user, nil
+}
 
 func getUserFromContext(r *http.Request) *store.User {
 	user, _ := r.Context().Value(userCtx).(*store.User)
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS user_invitations (
+  token bytea PRIMARY KEY,
+  user_id bigint NOT NULL,
+  expiry timestamp(0) with time zone NOT NULL,
+  CONSTRAINT fk_user_invitations_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
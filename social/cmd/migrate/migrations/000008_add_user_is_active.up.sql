@@ -0,0 +1,4 @@
+ALTER TABLE
+  users
+ADD
+  COLUMN is_active BOOLEAN NOT NULL DEFAULT FALSE;
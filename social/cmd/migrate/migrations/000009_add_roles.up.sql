@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS roles (
+  id bigserial PRIMARY KEY,
+  name varchar(255) NOT NULL UNIQUE,
+  level int NOT NULL DEFAULT 0,
+  description text
+);
+
+-- Higher levels inherit everything the lower ones are allowed to do
+INSERT INTO
+  roles (name, description, level)
+VALUES
+  ('user', 'A user can create posts and comments', 1),
+  ('moderator', 'A moderator can update other users posts', 2),
+  ('admin', 'An admin can update and delete other users posts', 3);
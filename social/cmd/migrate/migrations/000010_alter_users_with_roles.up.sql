@@ -0,0 +1,22 @@
+ALTER TABLE
+  IF EXISTS users
+ADD
+  COLUMN role_id bigint REFERENCES roles (id);
+
+-- Every existing user starts out with the lowest role
+UPDATE
+  users
+SET
+  role_id = (
+    SELECT
+      id
+    FROM
+      roles
+    WHERE
+      name = 'user'
+  );
+
+ALTER TABLE
+  users
+ALTER COLUMN
+  role_id SET NOT NULL;
@@ -0,0 +1,12 @@
+-- user_id is the user being followed, follower_id the one following them
+CREATE TABLE IF NOT EXISTS followers (
+  user_id bigint NOT NULL,
+  follower_id bigint NOT NULL,
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (user_id, follower_id),
+  CONSTRAINT fk_followers_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+  CONSTRAINT fk_followers_follower FOREIGN KEY (follower_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+-- The primary key covers lookups by user_id, this one covers "who do I follow"
+CREATE INDEX IF NOT EXISTS idx_followers_follower_id ON followers (follower_id);
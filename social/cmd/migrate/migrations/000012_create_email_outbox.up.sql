@@ -0,0 +1,21 @@
+-- Emails are written here in the same transaction as the rows they are
+-- about and sent later by a background worker
+CREATE TABLE IF NOT EXISTS email_outbox (
+  id bigserial PRIMARY KEY,
+  user_id bigint REFERENCES users (id) ON DELETE SET NULL,
+  template varchar(255) NOT NULL,
+  recipient_name varchar(255) NOT NULL,
+  recipient_email citext NOT NULL,
+  data jsonb,
+  attempts int NOT NULL DEFAULT 0,
+  last_error text,
+  next_attempt_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+  sent_at timestamp(0) with time zone,
+  failed_at timestamp(0) with time zone,
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_email_outbox_pending ON email_outbox (next_attempt_at)
+WHERE
+  sent_at IS NULL
+  AND failed_at IS NULL;
@@ -0,0 +1,11 @@
+-- Kept up to date by Postgres on every insert and update. Title matches
+-- weigh more than content ones when ranking.
+ALTER TABLE
+  posts
+ADD
+  COLUMN search tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+    setweight(to_tsvector('english', coalesce(content, '')), 'B')
+  ) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_posts_search ON posts USING GIN (search);
@@ -0,0 +1,7 @@
+-- Top level comments have no parent. Deleting a comment deletes its replies.
+ALTER TABLE
+  comments
+ADD
+  COLUMN parent_id bigint REFERENCES comments (id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS idx_comments_parent_id ON comments (parent_id);
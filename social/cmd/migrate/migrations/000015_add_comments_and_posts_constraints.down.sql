@@ -0,0 +1,25 @@
+ALTER TABLE
+  posts
+ALTER COLUMN
+  version DROP NOT NULL;
+
+ALTER TABLE
+  posts DROP CONSTRAINT fk_user,
+ADD
+  CONSTRAINT fk_user FOREIGN KEY (user_id) REFERENCES users (id);
+
+ALTER TABLE
+  comments DROP CONSTRAINT IF EXISTS fk_comments_post,
+  DROP CONSTRAINT IF EXISTS fk_comments_user;
+
+-- Back to bigserial. Comments deleted as orphans aren't restored.
+CREATE SEQUENCE IF NOT EXISTS comments_post_id_seq OWNED BY comments.post_id;
+
+CREATE SEQUENCE IF NOT EXISTS comments_user_id_seq OWNED BY comments.user_id;
+
+ALTER TABLE
+  comments
+ALTER COLUMN
+  post_id SET DEFAULT nextval('comments_post_id_seq'),
+ALTER COLUMN
+  user_id SET DEFAULT nextval('comments_user_id_seq');
@@ -0,0 +1,45 @@
+-- comments.post_id and user_id were declared bigserial, which gave them a
+-- sequence as default. They're plain references to posts and users.
+ALTER TABLE
+  comments
+ALTER COLUMN
+  post_id DROP DEFAULT,
+ALTER COLUMN
+  user_id DROP DEFAULT;
+
+DROP SEQUENCE IF EXISTS comments_post_id_seq;
+
+DROP SEQUENCE IF EXISTS comments_user_id_seq;
+
+-- Without foreign keys comments outlived their posts and users, they have
+-- to go before the constraints can be added
+DELETE FROM
+  comments c
+WHERE
+  NOT EXISTS (SELECT 1 FROM posts p WHERE p.id = c.post_id)
+  OR NOT EXISTS (SELECT 1 FROM users u WHERE u.id = c.user_id);
+
+ALTER TABLE
+  comments
+ADD
+  CONSTRAINT fk_comments_post FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE,
+ADD
+  CONSTRAINT fk_comments_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE;
+
+-- Deleting a user deletes their posts, and with them the posts' comments
+ALTER TABLE
+  posts DROP CONSTRAINT fk_user,
+ADD
+  CONSTRAINT fk_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE;
+
+UPDATE
+  posts
+SET
+  version = 0
+WHERE
+  version IS NULL;
+
+ALTER TABLE
+  posts
+ALTER COLUMN
+  version SET NOT NULL;
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_posts_created_at;
+
+DROP INDEX IF EXISTS idx_posts_user_id;
+
+DROP INDEX IF EXISTS idx_comments_user_id;
+
+DROP INDEX IF EXISTS idx_comments_post_id;
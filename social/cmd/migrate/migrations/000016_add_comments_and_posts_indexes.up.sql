@@ -0,0 +1,12 @@
+-- Listing a post's comments oldest first, counting them and cascading post
+-- deletes
+CREATE INDEX IF NOT EXISTS idx_comments_post_id ON comments (post_id, created_at, id);
+
+-- Cascading user deletes
+CREATE INDEX IF NOT EXISTS idx_comments_user_id ON comments (user_id);
+
+-- The feed selects the posts of a set of users, newest first
+CREATE INDEX IF NOT EXISTS idx_posts_user_id ON posts (user_id, created_at, id);
+
+-- Keyset pagination of the feed over (created_at, id)
+CREATE INDEX IF NOT EXISTS idx_posts_created_at ON posts (created_at, id);
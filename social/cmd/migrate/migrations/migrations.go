@@ -0,0 +1,10 @@
+// Package migrations holds the SQL migrations of the database schema, see
+// internal/migrate for how they're applied.
+package migrations
+
+import "embed"
+
+// FS has a NNNNNN_name.up.sql and a NNNNNN_name.down.sql file per version.
+//
+//go:embed *.sql
+var FS embed.FS
@@ -21,6 +21,5 @@ func main() {
 
 	store := store.NewPostgresStorage(conn)
 
-	// db.Seed(store, conn)
-	db.Seed(store)
+	db.Seed(store, conn)
 }
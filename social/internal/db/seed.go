@@ -2,6 +2,7 @@ package db
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 	"log"
 	"math/rand"
@@ -71,24 +72,29 @@ var comments = []string{
 	"Thanks for the information, very useful.",
 }
 
-// func Seed(store store.Storage, db *sql.DB) {
-func Seed(store store.Storage) {
+func Seed(store store.Storage, db *sql.DB) {
 	ctx := context.Background()
 
 	users := generateUsers(100)
-	// tx, _ := db.BeginTx(ctx, nil)
-	//
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		log.Println("Error starting transaction:", err)
+		return
+	}
+
 	for _, user := range users {
-		// if err := store.Users.Create(ctx, tx, user); err != nil {
-		if err := store.Users.Create(ctx, user); err != nil {
-			// _ = tx.Rollback()
+		if err := store.Users.Create(ctx, tx, user); err != nil {
+			_ = tx.Rollback()
 			log.Println("Error creating user:", err)
 			return
 		}
 	}
-	//
-	// tx.Commit()
-	//
+
+	if err := tx.Commit(); err != nil {
+		log.Println("Error committing users:", err)
+		return
+	}
+
 	posts := generatePosts(200, users)
 	for _, post := range posts {
 		if err := store.Posts.Create(ctx, post); err != nil {
@@ -115,10 +121,15 @@ func generateUsers(num int) []*store.User {
 		users[i] = &store.User{
 			Username: usernames[i%len(usernames)] + fmt.Sprintf("%d", i),
 			Email:    usernames[i%len(usernames)] + fmt.Sprintf("%d", i) + "@example.com",
-			Password: "123123",
-			// Role: store.Role{
-			// 	Name: "user",
-			// },
+			Role: store.Role{
+				Name: "user",
+			},
+			// there are no invitations to accept for seeded users
+			IsActive: true,
+		}
+
+		if err := users[i].Password.Set("123123"); err != nil {
+			log.Println("Error hashing password:", err)
 		}
 	}
 
@@ -0,0 +1,51 @@
+package mailer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const defaultBackoff = time.Second
+
+// postJSON sends payload to an email provider's HTTP API. 4xx answers other
+// than 429 are reported as permanent so they aren't retried. key is sent as
+// the Idempotency-Key header, it must be the same for every attempt at
+// sending the same email.
+func postJSON(client *http.Client, url, apiKey, key string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return &permanentError{err}
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return &permanentError{err}
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	req.Header.Set("Idempotency-Key", key)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	err = fmt.Errorf("email provider answered %d: %s", resp.StatusCode, bytes.TrimSpace(msg))
+
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+		return &permanentError{err}
+	}
+
+	return err
+}
@@ -0,0 +1,216 @@
+package mailer
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testAPIKey    = "test-key"
+	testFromEmail = "noreply@example.com"
+	testBackoff   = 20 * time.Millisecond
+)
+
+var testInvitation = struct {
+	Username      string
+	ActivationURL string
+}{
+	Username:      "gopher",
+	ActivationURL: "http://localhost:3000/confirm/abc",
+}
+
+// recordedRequest is what the stand-in provider saw of a request.
+type recordedRequest struct {
+	method        string
+	path          string
+	contentType   string
+	authorization string
+	key           string
+	body          map[string]any
+	at            time.Time
+}
+
+// standIn is an email provider API answering with statuses in turn, the
+// last one repeated once they run out.
+type standIn struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	statuses []int
+	requests []recordedRequest
+}
+
+func newStandIn(t *testing.T, statuses ...int) *standIn {
+	t.Helper()
+
+	s := &standIn{statuses: statuses}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func (s *standIn) handle(w http.ResponseWriter, r *http.Request) {
+	raw, _ := io.ReadAll(r.Body)
+
+	var body map[string]any
+	_ = json.Unmarshal(raw, &body)
+
+	s.mu.Lock()
+	status := s.statuses[min(len(s.requests), len(s.statuses)-1)]
+	s.requests = append(s.requests, recordedRequest{
+		method:        r.Method,
+		path:          r.URL.Path,
+		contentType:   r.Header.Get("Content-Type"),
+		authorization: r.Header.Get("Authorization"),
+		key:           r.Header.Get("Idempotency-Key"),
+		body:          body,
+		at:            time.Now(),
+	})
+	s.mu.Unlock()
+
+	w.WriteHeader(status)
+	if status >= 300 {
+		w.Write([]byte(`{"errors":["stand-in failure"]}`))
+	}
+}
+
+func (s *standIn) recorded() []recordedRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]recordedRequest(nil), s.requests...)
+}
+
+// retryCases are the provider answers every HTTP mailer has to handle the
+// same way.
+var retryCases = []struct {
+	name     string
+	statuses []int
+	wantErr  bool
+	attempts int
+}{
+	{name: "accepted", statuses: []int{http.StatusAccepted}, attempts: 1},
+	{name: "ok", statuses: []int{http.StatusOK}, attempts: 1},
+	{name: "bad request is permanent", statuses: []int{http.StatusBadRequest}, wantErr: true, attempts: 1},
+	{name: "unauthorized is permanent", statuses: []int{http.StatusUnauthorized}, wantErr: true, attempts: 1},
+	{name: "rate limited is retried", statuses: []int{http.StatusTooManyRequests}, wantErr: true, attempts: maxRetries},
+	{name: "server error is retried", statuses: []int{http.StatusInternalServerError}, wantErr: true, attempts: maxRetries},
+	{name: "recovers after retry", statuses: []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusAccepted}, attempts: 3},
+}
+
+// checkAttempts verifies the number of requests, that they're all the same
+// email to the provider and that the waits between them doubled starting at
+// testBackoff.
+func checkAttempts(t *testing.T, requests []recordedRequest, want int) {
+	t.Helper()
+
+	if len(requests) != want {
+		t.Fatalf("got %d requests, want %d", len(requests), want)
+	}
+
+	if requests[0].key == "" {
+		t.Error("no Idempotency-Key")
+	}
+
+	for i := 1; i < len(requests); i++ {
+		if requests[i].key != requests[0].key {
+			t.Errorf("attempt %d Idempotency-Key = %q, want %q", i+1, requests[i].key, requests[0].key)
+		}
+
+		wait := requests[i].at.Sub(requests[i-1].at)
+		if backoff := testBackoff << (i - 1); wait < backoff {
+			t.Errorf("attempt %d came %v after the previous one, want at least %v", i+1, wait, backoff)
+		}
+	}
+}
+
+func checkHeaders(t *testing.T, req recordedRequest) {
+	t.Helper()
+
+	if req.method != http.MethodPost {
+		t.Errorf("method = %q, want POST", req.method)
+	}
+	if req.contentType != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", req.contentType)
+	}
+	if want := "Bearer " + testAPIKey; req.authorization != want {
+		t.Errorf("Authorization = %q, want %q", req.authorization, want)
+	}
+}
+
+// field walks the decoded JSON body along path, indexing objects by key and
+// arrays by int.
+func field(t *testing.T, body any, path ...any) any {
+	t.Helper()
+
+	v := body
+	for _, p := range path {
+		switch p := p.(type) {
+		case string:
+			obj, ok := v.(map[string]any)
+			if !ok {
+				t.Fatalf("%v: not an object at %q", path, p)
+			}
+			v = obj[p]
+		case int:
+			arr, ok := v.([]any)
+			if !ok || p >= len(arr) {
+				t.Fatalf("%v: no item %d", path, p)
+			}
+			v = arr[p]
+		}
+	}
+
+	return v
+}
+
+func TestSendOnce(t *testing.T) {
+	mailers := []struct {
+		name string
+		new  func(*standIn) Client
+	}{
+		{name: "sendgrid", new: func(s *standIn) Client { return newTestSendGrid(s) }},
+		{name: "mailtrap", new: func(s *standIn) Client { return newTestMailTrap(s, "") }},
+	}
+
+	tests := []struct {
+		name          string
+		status        int
+		wantErr       bool
+		wantPermanent bool
+	}{
+		{name: "accepted", status: http.StatusAccepted},
+		{name: "bad request", status: http.StatusBadRequest, wantErr: true, wantPermanent: true},
+		{name: "rate limited", status: http.StatusTooManyRequests, wantErr: true},
+		{name: "server error", status: http.StatusInternalServerError, wantErr: true},
+	}
+
+	for _, m := range mailers {
+		for _, tt := range tests {
+			t.Run(m.name+"/"+tt.name, func(t *testing.T) {
+				s := newStandIn(t, tt.status)
+
+				err := m.new(s).SendOnce("outbox-42", UserInvitationTemplate, "gopher", "gopher@example.com", testInvitation, false)
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("SendOnce error = %v, want error: %v", err, tt.wantErr)
+				}
+				if IsPermanent(err) != tt.wantPermanent {
+					t.Errorf("IsPermanent = %v, want %v", IsPermanent(err), tt.wantPermanent)
+				}
+
+				requests := s.recorded()
+				checkAttempts(t, requests, 1)
+
+				if requests[0].key != "outbox-42" {
+					t.Errorf("Idempotency-Key = %q, want outbox-42", requests[0].key)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"html/template"
+	texttemplate "text/template"
+	"time"
+)
+
+const (
+	FromName               = "GopherSocial"
+	maxRetries             = 3
+	UserInvitationTemplate = "user_invitation.tmpl"
+)
+
+//go:embed "templates"
+var FS embed.FS
+
+// Client sends the email rendered from templateFile to a single recipient.
+// isSandbox asks providers that support it to accept the email without
+// delivering it.
+type Client interface {
+	Send(templateFile, username, email string, data any, isSandbox bool) error
+	// SendOnce makes a single attempt, for callers that schedule retries on
+	// their own. key identifies the email across those attempts, providers
+	// that support it use it to drop duplicates.
+	SendOnce(key, templateFile, username, email string, data any, isSandbox bool) error
+}
+
+// message is a rendered template, every template defines a "subject", a
+// "plainBody" and an "htmlBody".
+type message struct {
+	Subject   string
+	PlainBody string
+	HTMLBody  string
+}
+
+func render(templateFile string, data any) (*message, error) {
+	path := "templates/" + templateFile
+
+	// the plain text parts must not be HTML escaped
+	textTmpl, err := texttemplate.ParseFS(FS, path)
+	if err != nil {
+		return nil, err
+	}
+
+	htmlTmpl, err := template.ParseFS(FS, path)
+	if err != nil {
+		return nil, err
+	}
+
+	subject := new(bytes.Buffer)
+	if err := textTmpl.ExecuteTemplate(subject, "subject", data); err != nil {
+		return nil, err
+	}
+
+	plainBody := new(bytes.Buffer)
+	if err := textTmpl.ExecuteTemplate(plainBody, "plainBody", data); err != nil {
+		return nil, err
+	}
+
+	htmlBody := new(bytes.Buffer)
+	if err := htmlTmpl.ExecuteTemplate(htmlBody, "htmlBody", data); err != nil {
+		return nil, err
+	}
+
+	return &message{
+		Subject:   subject.String(),
+		PlainBody: plainBody.String(),
+		HTMLBody:  htmlBody.String(),
+	}, nil
+}
+
+// permanentError marks a failure retrying won't fix, like a rejected API key
+// or an invalid recipient.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// IsPermanent reports whether err, returned by SendOnce, won't go away by
+// sending again.
+func IsPermanent(err error) bool {
+	var perr *permanentError
+	return errors.As(err, &perr)
+}
+
+// withRetry calls send up to maxRetries times, doubling the wait between
+// attempts starting at backoff. Permanent errors are returned right away.
+func withRetry(backoff time.Duration, send func() error) error {
+	var err error
+	for i := 0; i < maxRetries; i++ {
+		err = send()
+		if err == nil {
+			return nil
+		}
+
+		var perr *permanentError
+		if errors.As(err, &perr) {
+			return perr.err
+		}
+
+		if i < maxRetries-1 {
+			time.Sleep(backoff << i)
+		}
+	}
+
+	return fmt.Errorf("failed to send email after %d attempts, error: %w", maxRetries, err)
+}
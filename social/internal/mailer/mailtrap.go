@@ -0,0 +1,100 @@
+package mailer
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	mailtrapBaseURL        = "https://send.api.mailtrap.io"
+	mailtrapSandboxBaseURL = "https://sandbox.api.mailtrap.io"
+)
+
+type MailTrapMailer struct {
+	fromEmail string
+	apiKey    string
+	inboxID   string
+	client    *http.Client
+	// BaseURL, SandboxBaseURL and Backoff can be overridden to point at a
+	// stand-in server
+	BaseURL        string
+	SandboxBaseURL string
+	Backoff        time.Duration
+}
+
+// NewMailTrap sends through the Mailtrap email API. inboxID is only needed
+// for sandbox sends, which land in that testing inbox instead of being
+// delivered.
+func NewMailTrap(apiKey, fromEmail, inboxID string) *MailTrapMailer {
+	return &MailTrapMailer{
+		fromEmail:      fromEmail,
+		apiKey:         apiKey,
+		inboxID:        inboxID,
+		client:         &http.Client{Timeout: 10 * time.Second},
+		BaseURL:        mailtrapBaseURL,
+		SandboxBaseURL: mailtrapSandboxBaseURL,
+		Backoff:        defaultBackoff,
+	}
+}
+
+type mailtrapAddress struct {
+	Email string `json:"email"`
+	Name  string `json:"name,omitempty"`
+}
+
+type mailtrapPayload struct {
+	From     mailtrapAddress   `json:"from"`
+	To       []mailtrapAddress `json:"to"`
+	Subject  string            `json:"subject"`
+	Text     string            `json:"text"`
+	HTML     string            `json:"html"`
+	Category string            `json:"category,omitempty"`
+}
+
+func (m *MailTrapMailer) Send(templateFile, username, email string, data any, isSandbox bool) error {
+	payload, err := m.payload(templateFile, username, email, data)
+	if err != nil {
+		return err
+	}
+
+	key := uuid.New().String()
+
+	return withRetry(m.Backoff, func() error {
+		return postJSON(m.client, m.url(isSandbox), m.apiKey, key, payload)
+	})
+}
+
+func (m *MailTrapMailer) SendOnce(key, templateFile, username, email string, data any, isSandbox bool) error {
+	payload, err := m.payload(templateFile, username, email, data)
+	if err != nil {
+		return &permanentError{err}
+	}
+
+	return postJSON(m.client, m.url(isSandbox), m.apiKey, key, payload)
+}
+
+func (m *MailTrapMailer) payload(templateFile, username, email string, data any) (*mailtrapPayload, error) {
+	msg, err := render(templateFile, data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &mailtrapPayload{
+		From:     mailtrapAddress{Email: m.fromEmail, Name: FromName},
+		To:       []mailtrapAddress{{Email: email, Name: username}},
+		Subject:  msg.Subject,
+		Text:     msg.PlainBody,
+		HTML:     msg.HTMLBody,
+		Category: templateFile,
+	}, nil
+}
+
+func (m *MailTrapMailer) url(isSandbox bool) string {
+	if isSandbox && m.inboxID != "" {
+		return m.SandboxBaseURL + "/api/send/" + m.inboxID
+	}
+
+	return m.BaseURL + "/api/send"
+}
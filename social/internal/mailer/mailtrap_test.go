@@ -0,0 +1,93 @@
+package mailer
+
+import (
+	"strings"
+	"testing"
+)
+
+func newTestMailTrap(s *standIn, inboxID string) *MailTrapMailer {
+	m := NewMailTrap(testAPIKey, testFromEmail, inboxID)
+	m.BaseURL = s.URL
+	m.SandboxBaseURL = s.URL + "/sandbox"
+	m.Backoff = testBackoff
+
+	return m
+}
+
+func TestMailTrapPayload(t *testing.T) {
+	tests := []struct {
+		name      string
+		inboxID   string
+		isSandbox bool
+		wantPath  string
+	}{
+		{name: "delivered", isSandbox: false, wantPath: "/api/send"},
+		{name: "sandbox", inboxID: "42", isSandbox: true, wantPath: "/sandbox/api/send/42"},
+		{name: "sandbox without inbox", isSandbox: true, wantPath: "/api/send"},
+		{name: "inbox outside sandbox", inboxID: "42", isSandbox: false, wantPath: "/api/send"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newStandIn(t, 200)
+			m := newTestMailTrap(s, tt.inboxID)
+
+			err := m.Send(UserInvitationTemplate, "gopher", "gopher@example.com", testInvitation, tt.isSandbox)
+			if err != nil {
+				t.Fatalf("Send: %v", err)
+			}
+
+			requests := s.recorded()
+			checkAttempts(t, requests, 1)
+
+			req := requests[0]
+			checkHeaders(t, req)
+
+			if req.path != tt.wantPath {
+				t.Errorf("path = %q, want %q", req.path, tt.wantPath)
+			}
+
+			body := req.body
+			if got := field(t, body, "to", 0, "email"); got != "gopher@example.com" {
+				t.Errorf("to email = %v", got)
+			}
+			if got := field(t, body, "to", 0, "name"); got != "gopher" {
+				t.Errorf("to name = %v", got)
+			}
+			if got := field(t, body, "from", "email"); got != testFromEmail {
+				t.Errorf("from email = %v", got)
+			}
+			if got := field(t, body, "from", "name"); got != FromName {
+				t.Errorf("from name = %v", got)
+			}
+			if got := field(t, body, "subject"); got != "Finish Registration with GopherSocial" {
+				t.Errorf("subject = %v", got)
+			}
+			if got := field(t, body, "category"); got != UserInvitationTemplate {
+				t.Errorf("category = %v, want %q", got, UserInvitationTemplate)
+			}
+			for _, key := range []string{"text", "html"} {
+				value, _ := field(t, body, key).(string)
+				if !strings.Contains(value, testInvitation.ActivationURL) {
+					t.Errorf("%s doesn't have the activation URL", key)
+				}
+			}
+		})
+	}
+}
+
+func TestMailTrapRetries(t *testing.T) {
+	for _, tt := range retryCases {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newStandIn(t, tt.statuses...)
+			m := newTestMailTrap(s, "")
+
+			err := m.Send(UserInvitationTemplate, "gopher", "gopher@example.com", testInvitation, false)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Send error = %v, want error: %v", err, tt.wantErr)
+			}
+
+			checkAttempts(t, s.recorded(), tt.attempts)
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package mailer
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const sendGridBaseURL = "https://api.sendgrid.com"
+
+type SendGridMailer struct {
+	fromEmail string
+	apiKey    string
+	client    *http.Client
+	// BaseURL and Backoff can be overridden to point at a stand-in server
+	BaseURL string
+	Backoff time.Duration
+}
+
+func NewSendgrid(apiKey, fromEmail string) *SendGridMailer {
+	return &SendGridMailer{
+		fromEmail: fromEmail,
+		apiKey:    apiKey,
+		client:    &http.Client{Timeout: 10 * time.Second},
+		BaseURL:   sendGridBaseURL,
+		Backoff:   defaultBackoff,
+	}
+}
+
+type sendGridAddress struct {
+	Email string `json:"email"`
+	Name  string `json:"name,omitempty"`
+}
+
+type sendGridContent struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type sendGridPayload struct {
+	Personalizations []struct {
+		To []sendGridAddress `json:"to"`
+	} `json:"personalizations"`
+	From         sendGridAddress   `json:"from"`
+	Subject      string            `json:"subject"`
+	Content      []sendGridContent `json:"content"`
+	MailSettings struct {
+		SandboxMode struct {
+			Enable bool `json:"enable"`
+		} `json:"sandbox_mode"`
+	} `json:"mail_settings"`
+}
+
+func (m *SendGridMailer) Send(templateFile, username, email string, data any, isSandbox bool) error {
+	payload, err := m.payload(templateFile, username, email, data, isSandbox)
+	if err != nil {
+		return err
+	}
+
+	key := uuid.New().String()
+
+	return withRetry(m.Backoff, func() error {
+		return postJSON(m.client, m.BaseURL+"/v3/mail/send", m.apiKey, key, payload)
+	})
+}
+
+func (m *SendGridMailer) SendOnce(key, templateFile, username, email string, data any, isSandbox bool) error {
+	payload, err := m.payload(templateFile, username, email, data, isSandbox)
+	if err != nil {
+		return &permanentError{err}
+	}
+
+	return postJSON(m.client, m.BaseURL+"/v3/mail/send", m.apiKey, key, payload)
+}
+
+func (m *SendGridMailer) payload(templateFile, username, email string, data any, isSandbox bool) (*sendGridPayload, error) {
+	msg, err := render(templateFile, data)
+	if err != nil {
+		return nil, err
+	}
+
+	var payload sendGridPayload
+	payload.Personalizations = make([]struct {
+		To []sendGridAddress `json:"to"`
+	}, 1)
+	payload.Personalizations[0].To = []sendGridAddress{{Email: email, Name: username}}
+	payload.From = sendGridAddress{Email: m.fromEmail, Name: FromName}
+	payload.Subject = msg.Subject
+	// SendGrid wants text/plain before text/html
+	payload.Content = []sendGridContent{
+		{Type: "text/plain", Value: msg.PlainBody},
+		{Type: "text/html", Value: msg.HTMLBody},
+	}
+	payload.MailSettings.SandboxMode.Enable = isSandbox
+
+	return &payload, nil
+}
@@ -0,0 +1,94 @@
+package mailer
+
+import (
+	"strings"
+	"testing"
+)
+
+func newTestSendGrid(s *standIn) *SendGridMailer {
+	m := NewSendgrid(testAPIKey, testFromEmail)
+	m.BaseURL = s.URL
+	m.Backoff = testBackoff
+
+	return m
+}
+
+func TestSendGridPayload(t *testing.T) {
+	tests := []struct {
+		name      string
+		isSandbox bool
+	}{
+		{name: "delivered", isSandbox: false},
+		{name: "sandbox", isSandbox: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newStandIn(t, 202)
+			m := newTestSendGrid(s)
+
+			err := m.Send(UserInvitationTemplate, "gopher", "gopher@example.com", testInvitation, tt.isSandbox)
+			if err != nil {
+				t.Fatalf("Send: %v", err)
+			}
+
+			requests := s.recorded()
+			checkAttempts(t, requests, 1)
+
+			req := requests[0]
+			checkHeaders(t, req)
+
+			if req.path != "/v3/mail/send" {
+				t.Errorf("path = %q, want /v3/mail/send", req.path)
+			}
+
+			body := req.body
+			if got := field(t, body, "personalizations", 0, "to", 0, "email"); got != "gopher@example.com" {
+				t.Errorf("to email = %v", got)
+			}
+			if got := field(t, body, "personalizations", 0, "to", 0, "name"); got != "gopher" {
+				t.Errorf("to name = %v", got)
+			}
+			if got := field(t, body, "from", "email"); got != testFromEmail {
+				t.Errorf("from email = %v", got)
+			}
+			if got := field(t, body, "from", "name"); got != FromName {
+				t.Errorf("from name = %v", got)
+			}
+			if got := field(t, body, "subject"); got != "Finish Registration with GopherSocial" {
+				t.Errorf("subject = %v", got)
+			}
+			if got := field(t, body, "content", 0, "type"); got != "text/plain" {
+				t.Errorf("first content type = %v, want text/plain", got)
+			}
+			if got := field(t, body, "content", 1, "type"); got != "text/html" {
+				t.Errorf("second content type = %v, want text/html", got)
+			}
+			for i := range 2 {
+				value, _ := field(t, body, "content", i, "value").(string)
+				if !strings.Contains(value, testInvitation.ActivationURL) {
+					t.Errorf("content %d doesn't have the activation URL", i)
+				}
+			}
+			if got := field(t, body, "mail_settings", "sandbox_mode", "enable"); got != tt.isSandbox {
+				t.Errorf("sandbox_mode.enable = %v, want %v", got, tt.isSandbox)
+			}
+		})
+	}
+}
+
+func TestSendGridRetries(t *testing.T) {
+	for _, tt := range retryCases {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newStandIn(t, tt.statuses...)
+			m := newTestSendGrid(s)
+
+			err := m.Send(UserInvitationTemplate, "gopher", "gopher@example.com", testInvitation, false)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Send error = %v, want error: %v", err, tt.wantErr)
+			}
+
+			checkAttempts(t, s.recorded(), tt.attempts)
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SMTPMailer delivers through a plain SMTP server, like a local Mailpit or
+// MailHog during development. isSandbox has no meaning here and is ignored.
+type SMTPMailer struct {
+	fromEmail string
+	addr      string
+	auth      smtp.Auth
+	Backoff   time.Duration
+}
+
+// NewSMTP connects to host:port, authenticating only when a username is set.
+func NewSMTP(host string, port int, username, password, fromEmail string) *SMTPMailer {
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return &SMTPMailer{
+		fromEmail: fromEmail,
+		addr:      net.JoinHostPort(host, strconv.Itoa(port)),
+		auth:      auth,
+		Backoff:   defaultBackoff,
+	}
+}
+
+func (m *SMTPMailer) Send(templateFile, username, email string, data any, isSandbox bool) error {
+	body, err := m.build(uuid.New().String(), templateFile, username, email, data)
+	if err != nil {
+		return err
+	}
+
+	return withRetry(m.Backoff, func() error {
+		return m.send(email, body)
+	})
+}
+
+func (m *SMTPMailer) SendOnce(key, templateFile, username, email string, data any, isSandbox bool) error {
+	body, err := m.build(key, templateFile, username, email, data)
+	if err != nil {
+		return &permanentError{err}
+	}
+
+	return m.send(email, body)
+}
+
+// send hands body to the server. 5xx replies, like an unknown recipient or
+// rejected credentials, are permanent, 4xx ones are worth another try.
+func (m *SMTPMailer) send(email string, body []byte) error {
+	err := smtp.SendMail(m.addr, m.auth, m.fromEmail, []string{email}, body)
+
+	var replyErr *textproto.Error
+	if errors.As(err, &replyErr) && replyErr.Code >= 500 {
+		return &permanentError{err}
+	}
+
+	return err
+}
+
+// build renders the email with key in its Message-ID, so that receivers can
+// recognise the copies of an email sent more than once.
+func (m *SMTPMailer) build(key, templateFile, username, email string, data any) ([]byte, error) {
+	msg, err := render(templateFile, data)
+	if err != nil {
+		return nil, err
+	}
+
+	_, domain, _ := strings.Cut(m.fromEmail, "@")
+	messageID := fmt.Sprintf("<%s@%s>", key, domain)
+
+	return buildMIME(messageID, FromName, m.fromEmail, username, email, msg)
+}
+
+// Ping checks the SMTP server accepts connections.
+func (m *SMTPMailer) Ping(ctx context.Context) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", m.addr)
+	if err != nil {
+		return err
+	}
+
+	return conn.Close()
+}
+
+// buildMIME renders msg as a multipart/alternative email with a plain text
+// and an HTML part.
+func buildMIME(messageID, fromName, fromEmail, toName, toEmail string, msg *message) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	mw := multipart.NewWriter(buf)
+
+	fmt.Fprintf(buf, "From: %s <%s>\r\n", mime.QEncoding.Encode("utf-8", fromName), fromEmail)
+	fmt.Fprintf(buf, "To: %s <%s>\r\n", mime.QEncoding.Encode("utf-8", toName), toEmail)
+	fmt.Fprintf(buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(buf, "Message-ID: %s\r\n", messageID)
+	fmt.Fprintf(buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(buf, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", mw.Boundary())
+
+	parts := []struct {
+		contentType string
+		body        string
+	}{
+		{"text/plain; charset=utf-8", msg.PlainBody},
+		{"text/html; charset=utf-8", msg.HTMLBody},
+	}
+
+	for _, p := range parts {
+		w, err := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {p.contentType}})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write([]byte(p.body)); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,189 @@
+package mailer
+
+import (
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// smtpStandIn is an SMTP server answering RCPT TO with codes in turn, the
+// last one repeated once they run out. Everything else is accepted.
+type smtpStandIn struct {
+	ln net.Listener
+
+	mu       sync.Mutex
+	codes    []int
+	sessions int
+	messages []string
+}
+
+func newSMTPStandIn(t *testing.T, codes ...int) *smtpStandIn {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &smtpStandIn{ln: ln, codes: codes}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+
+	return s
+}
+
+func (s *smtpStandIn) serve(conn net.Conn) {
+	defer conn.Close()
+
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 stand-in ready")
+
+	s.mu.Lock()
+	rcptCode := s.codes[min(s.sessions, len(s.codes)-1)]
+	s.sessions++
+	s.mu.Unlock()
+
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+
+		verb, _, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(strings.TrimRight(verb, ":")) {
+		case "EHLO", "HELO", "MAIL":
+			tp.PrintfLine("250 ok")
+		case "RCPT":
+			if rcptCode >= 300 {
+				tp.PrintfLine("%d stand-in failure", rcptCode)
+				continue
+			}
+			tp.PrintfLine("250 ok")
+		case "DATA":
+			tp.PrintfLine("354 go ahead")
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.messages = append(s.messages, string(data))
+			s.mu.Unlock()
+			tp.PrintfLine("250 queued")
+		case "QUIT":
+			tp.PrintfLine("221 bye")
+			return
+		default:
+			tp.PrintfLine("502 not implemented")
+		}
+	}
+}
+
+func (s *smtpStandIn) recorded() (sessions int, messages []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.sessions, append([]string(nil), s.messages...)
+}
+
+func newTestSMTP(t *testing.T, s *smtpStandIn) *SMTPMailer {
+	t.Helper()
+
+	host, port, err := net.SplitHostPort(s.ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, _ := strconv.Atoi(port)
+
+	m := NewSMTP(host, p, "", "", testFromEmail)
+	m.Backoff = testBackoff
+
+	return m
+}
+
+func TestSMTPSendOnce(t *testing.T) {
+	tests := []struct {
+		name          string
+		code          int
+		wantErr       bool
+		wantPermanent bool
+	}{
+		{name: "accepted", code: 250},
+		{name: "mailbox unavailable", code: 550, wantErr: true, wantPermanent: true},
+		{name: "rejected", code: 554, wantErr: true, wantPermanent: true},
+		{name: "mailbox busy", code: 450, wantErr: true},
+		{name: "server busy", code: 421, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSMTPStandIn(t, tt.code)
+
+			err := newTestSMTP(t, s).SendOnce("outbox-42", UserInvitationTemplate, "gopher", "gopher@example.com", testInvitation, false)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SendOnce error = %v, want error: %v", err, tt.wantErr)
+			}
+			if IsPermanent(err) != tt.wantPermanent {
+				t.Errorf("IsPermanent(%v) = %v, want %v", err, IsPermanent(err), tt.wantPermanent)
+			}
+
+			sessions, messages := s.recorded()
+			if sessions != 1 {
+				t.Errorf("%d sessions, want 1", sessions)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if len(messages) != 1 {
+				t.Fatalf("%d messages delivered, want 1", len(messages))
+			}
+			if !strings.Contains(messages[0], "Message-ID: <outbox-42@example.com>") {
+				t.Error("the Message-ID doesn't carry the key")
+			}
+			if !strings.Contains(messages[0], testInvitation.ActivationURL) {
+				t.Error("the message doesn't have the activation URL")
+			}
+		})
+	}
+}
+
+func TestSMTPRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		codes    []int
+		wantErr  bool
+		sessions int
+	}{
+		{name: "accepted", codes: []int{250}, sessions: 1},
+		{name: "permanent failure", codes: []int{550}, wantErr: true, sessions: 1},
+		{name: "temporary failure is retried", codes: []int{451}, wantErr: true, sessions: maxRetries},
+		{name: "recovers after retry", codes: []int{451, 421, 250}, sessions: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSMTPStandIn(t, tt.codes...)
+
+			err := newTestSMTP(t, s).Send(UserInvitationTemplate, "gopher", "gopher@example.com", testInvitation, false)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Send error = %v, want error: %v", err, tt.wantErr)
+			}
+
+			if sessions, _ := s.recorded(); sessions != tt.sessions {
+				t.Errorf("%d sessions, want %d", sessions, tt.sessions)
+			}
+		})
+	}
+}
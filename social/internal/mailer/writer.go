@@ -0,0 +1,40 @@
+package mailer
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// WriterMailer doesn't deliver anything, it writes the rendered emails to w
+// (stdout or a file) so activation links can be picked up during development.
+type WriterMailer struct {
+	mu        sync.Mutex
+	w         io.Writer
+	fromEmail string
+}
+
+func NewWriterMailer(w io.Writer, fromEmail string) *WriterMailer {
+	return &WriterMailer{w: w, fromEmail: fromEmail}
+}
+
+func (m *WriterMailer) Send(templateFile, username, email string, data any, isSandbox bool) error {
+	msg, err := render(templateFile, data)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, err = fmt.Fprintf(m.w,
+		"-----\nFrom: %s <%s>\nTo: %s <%s>\nSubject: %s\n%s\n",
+		FromName, m.fromEmail, username, email, msg.Subject, msg.PlainBody,
+	)
+
+	return err
+}
+
+func (m *WriterMailer) SendOnce(key, templateFile, username, email string, data any, isSandbox bool) error {
+	return m.Send(templateFile, username, email, data, isSandbox)
+}
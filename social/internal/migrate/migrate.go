@@ -0,0 +1,344 @@
+// Package migrate applies SQL migrations to Postgres. It keeps its state in
+// the same schema_migrations table as the migrate CLI, so databases migrated
+// with either can be taken over by the other.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// lockKey is the Postgres advisory lock held while migrating, it keeps API
+// replicas started at the same time from applying migrations concurrently.
+const lockKey int64 = 7_180_452_916_362_031
+
+var (
+	ErrDirty          = errors.New("database is dirty, fix it by hand and force a version")
+	ErrUnknownVersion = errors.New("no migration with that version")
+)
+
+var filenameRe = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+type migration struct {
+	version int64
+	name    string
+	up      string
+	down    string
+}
+
+// Status is a migration and whether it's applied.
+type Status struct {
+	Version int64
+	Name    string
+	Applied bool
+}
+
+type Migrator struct {
+	db         *sql.DB
+	migrations []migration
+	// Log reports every migration applied or rolled back, it does nothing
+	// by default.
+	Log func(format string, v ...any)
+}
+
+// New reads the migrations in fsys, which must have both an up and a down
+// file for every version, e.g. 000001_create_users.up.sql and
+// 000001_create_users.down.sql.
+func New(db *sql.DB, fsys fs.FS) (*Migrator, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*migration)
+	for _, entry := range entries {
+		match := filenameRe.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: %w", entry.Name(), err)
+		}
+
+		body, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &migration{version: version, name: match[2]}
+			byVersion[version] = m
+		}
+
+		if match[3] == "up" {
+			m.up = string(body)
+		} else {
+			m.down = string(body)
+		}
+	}
+
+	migrations := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.up == "" || m.down == "" {
+			return nil, fmt.Errorf("migration %d_%s: missing up or down file", m.version, m.name)
+		}
+		migrations = append(migrations, *m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].version < migrations[j].version
+	})
+
+	return &Migrator{
+		db:         db,
+		migrations: migrations,
+		Log:        func(string, ...any) {},
+	}, nil
+}
+
+// Up applies every pending migration.
+func (m *Migrator) Up(ctx context.Context) error {
+	if len(m.migrations) == 0 {
+		return nil
+	}
+
+	return m.Goto(ctx, m.migrations[len(m.migrations)-1].version)
+}
+
+// Down rolls back the last n applied migrations, or as many as there are.
+func (m *Migrator) Down(ctx context.Context, n int) error {
+	if n < 1 {
+		return fmt.Errorf("can't roll back %d migrations", n)
+	}
+
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		current, err := m.cleanVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		i := m.index(current)
+		target := int64(0)
+		if i-n >= 0 {
+			target = m.migrations[i-n].version
+		}
+
+		return m.migrateTo(ctx, conn, current, target)
+	})
+}
+
+// Goto applies or rolls back migrations until version is the current one.
+// Version 0 rolls everything back.
+func (m *Migrator) Goto(ctx context.Context, version int64) error {
+	if version != 0 && m.index(version) < 0 {
+		return fmt.Errorf("%w: %d", ErrUnknownVersion, version)
+	}
+
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		current, err := m.cleanVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		return m.migrateTo(ctx, conn, current, version)
+	})
+}
+
+// Version returns the current version, 0 when no migration is applied,
+// and whether the last migration failed half way.
+func (m *Migrator) Version(ctx context.Context) (version int64, dirty bool, err error) {
+	err = m.withLock(ctx, func(conn *sql.Conn) error {
+		version, dirty, err = readVersion(ctx, conn)
+		return err
+	})
+
+	return version, dirty, err
+}
+
+// Force sets the current version without running any migration and clears
+// the dirty flag, once a failed migration has been fixed by hand.
+func (m *Migrator) Force(ctx context.Context, version int64) error {
+	if version != 0 && m.index(version) < 0 {
+		return fmt.Errorf("%w: %d", ErrUnknownVersion, version)
+	}
+
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+
+		if err := writeVersion(ctx, tx, version); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+
+		return tx.Commit()
+	})
+}
+
+// Status lists every migration, oldest first.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	version, _, err := m.Version(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		statuses = append(statuses, Status{
+			Version: mig.version,
+			Name:    mig.name,
+			Applied: mig.version <= version,
+		})
+	}
+
+	return statuses, nil
+}
+
+// migrateTo steps from the current version to target, one migration per
+// transaction. A failed migration is rolled back entirely, so it leaves
+// the database at the version before it.
+func (m *Migrator) migrateTo(ctx context.Context, conn *sql.Conn, current, target int64) error {
+	for current < target {
+		next := m.migrations[m.index(current)+1]
+
+		m.Log("applying %d_%s", next.version, next.name)
+		if err := m.apply(ctx, conn, next.up, next.version); err != nil {
+			return fmt.Errorf("migration %d_%s up: %w", next.version, next.name, err)
+		}
+
+		current = next.version
+	}
+
+	for current > target {
+		i := m.index(current)
+		mig := m.migrations[i]
+
+		previous := int64(0)
+		if i > 0 {
+			previous = m.migrations[i-1].version
+		}
+
+		m.Log("rolling back %d_%s", mig.version, mig.name)
+		if err := m.apply(ctx, conn, mig.down, previous); err != nil {
+			return fmt.Errorf("migration %d_%s down: %w", mig.version, mig.name, err)
+		}
+
+		current = previous
+	}
+
+	return nil
+}
+
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, query string, version int64) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, query); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	if err := writeVersion(ctx, tx, version); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// index returns the position of version in m.migrations, -1 for version 0
+// and for unknown versions.
+func (m *Migrator) index(version int64) int {
+	for i, mig := range m.migrations {
+		if mig.version == version {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// cleanVersion is the current version, it fails if the database is dirty
+// or at a version there's no migration for.
+func (m *Migrator) cleanVersion(ctx context.Context, conn *sql.Conn) (int64, error) {
+	version, dirty, err := readVersion(ctx, conn)
+	if err != nil {
+		return 0, err
+	}
+
+	if dirty {
+		return 0, fmt.Errorf("%w (version %d)", ErrDirty, version)
+	}
+
+	if version != 0 && m.index(version) < 0 {
+		return 0, fmt.Errorf("%w: database is at %d", ErrUnknownVersion, version)
+	}
+
+	return version, nil
+}
+
+// withLock runs fn holding the advisory lock. Advisory locks belong to the
+// session, so everything in fn has to go through conn.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, lockKey); err != nil {
+		return err
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, lockKey)
+
+	query := `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version bigint NOT NULL PRIMARY KEY,
+			dirty boolean NOT NULL
+		)
+	`
+	if _, err := conn.ExecContext(ctx, query); err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
+
+func readVersion(ctx context.Context, conn *sql.Conn) (version int64, dirty bool, err error) {
+	query := `SELECT version, dirty FROM schema_migrations LIMIT 1`
+
+	err = conn.QueryRowContext(ctx, query).Scan(&version, &dirty)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+
+	return version, dirty, err
+}
+
+// writeVersion records version as the current one, no row stands for
+// version 0.
+func writeVersion(ctx context.Context, tx *sql.Tx, version int64) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM schema_migrations`); err != nil {
+		return err
+	}
+
+	if version == 0 {
+		return nil
+	}
+
+	_, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, dirty) VALUES ($1, false)`, version)
+	return err
+}
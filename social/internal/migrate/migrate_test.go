@@ -0,0 +1,188 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"social/cmd/migrate/migrations"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+// freshDB creates an empty database next to the one TEST_DB_ADDR points at,
+// dropped when the test ends. The test is skipped without TEST_DB_ADDR.
+func freshDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	addr := os.Getenv("TEST_DB_ADDR")
+	if addr == "" {
+		t.Skip("TEST_DB_ADDR not set")
+	}
+
+	admin, err := sql.Open("postgres", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	name := fmt.Sprintf("social_migrate_test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec("CREATE DATABASE " + name); err != nil {
+		t.Fatalf("creating database: %v", err)
+	}
+
+	u, err := url.Parse(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.Path = "/" + name
+
+	db, err := sql.Open("postgres", u.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		db.Close()
+		if _, err := admin.Exec("DROP DATABASE IF EXISTS " + name); err != nil {
+			t.Errorf("dropping database: %v", err)
+		}
+	})
+
+	return db
+}
+
+// TestMigrationsFromZero applies the whole schema to an empty database,
+// rolls it all back and applies it again.
+func TestMigrationsFromZero(t *testing.T) {
+	db := freshDB(t)
+	ctx := context.Background()
+
+	m, err := New(db, migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	latest := m.migrations[len(m.migrations)-1].version
+
+	if err := m.Up(ctx); err != nil {
+		t.Fatalf("first up: %v", err)
+	}
+	checkVersion(t, m, latest)
+	checkSchema(t, db)
+
+	if err := m.Goto(ctx, 0); err != nil {
+		t.Fatalf("goto 0: %v", err)
+	}
+	checkVersion(t, m, 0)
+
+	var tables []string
+	rows, err := db.Query(`
+		SELECT table_name FROM information_schema.tables
+		WHERE table_schema = 'public' AND table_name <> 'schema_migrations'
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			t.Fatal(err)
+		}
+		tables = append(tables, table)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(tables) > 0 {
+		t.Errorf("tables left after rolling everything back: %v", tables)
+	}
+
+	if err := m.Up(ctx); err != nil {
+		t.Fatalf("second up: %v", err)
+	}
+	checkVersion(t, m, latest)
+	checkSchema(t, db)
+}
+
+func checkVersion(t *testing.T, m *Migrator, want int64) {
+	t.Helper()
+
+	version, dirty, err := m.Version(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != want || dirty {
+		t.Errorf("version = %d (dirty: %v), want %d", version, dirty, want)
+	}
+}
+
+// checkSchema verifies the foreign keys and indexes the store relies on.
+func checkSchema(t *testing.T, db *sql.DB) {
+	t.Helper()
+
+	foreignKeys := []struct {
+		table, column, references, onDelete string
+	}{
+		{"posts", "user_id", "users", "CASCADE"},
+		{"comments", "post_id", "posts", "CASCADE"},
+		{"comments", "user_id", "users", "CASCADE"},
+		{"comments", "parent_id", "comments", "CASCADE"},
+		{"user_invitations", "user_id", "users", "CASCADE"},
+		{"followers", "user_id", "users", "CASCADE"},
+		{"followers", "follower_id", "users", "CASCADE"},
+		{"email_outbox", "user_id", "users", "SET NULL"},
+	}
+
+	for _, fk := range foreignKeys {
+		query := `
+			SELECT ccu.table_name, rc.delete_rule
+			FROM information_schema.referential_constraints rc
+			JOIN information_schema.key_column_usage kcu
+				ON kcu.constraint_name = rc.constraint_name AND kcu.constraint_schema = rc.constraint_schema
+			JOIN information_schema.constraint_column_usage ccu
+				ON ccu.constraint_name = rc.constraint_name AND ccu.constraint_schema = rc.constraint_schema
+			WHERE kcu.table_schema = 'public' AND kcu.table_name = $1 AND kcu.column_name = $2
+		`
+
+		var references, onDelete string
+		err := db.QueryRow(query, fk.table, fk.column).Scan(&references, &onDelete)
+		if err != nil {
+			t.Errorf("foreign key on %s.%s: %v", fk.table, fk.column, err)
+			continue
+		}
+		if references != fk.references || onDelete != fk.onDelete {
+			t.Errorf("%s.%s references %s ON DELETE %s, want %s ON DELETE %s",
+				fk.table, fk.column, references, onDelete, fk.references, fk.onDelete)
+		}
+	}
+
+	indexes := []struct {
+		table, name string
+	}{
+		{"comments", "idx_comments_post_id"},
+		{"comments", "idx_comments_user_id"},
+		{"comments", "idx_comments_parent_id"},
+		{"posts", "idx_posts_user_id"},
+		{"posts", "idx_posts_created_at"},
+		{"posts", "idx_posts_search"},
+		{"followers", "idx_followers_follower_id"},
+		{"email_outbox", "idx_email_outbox_pending"},
+	}
+
+	for _, idx := range indexes {
+		var exists bool
+		err := db.QueryRow(
+			`SELECT EXISTS (SELECT 1 FROM pg_indexes WHERE schemaname = 'public' AND tablename = $1 AND indexname = $2)`,
+			idx.table, idx.name,
+		).Scan(&exists)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !exists {
+			t.Errorf("missing index %s on %s", idx.name, idx.table)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package ratelimiter
+
+import (
+	"sync"
+	"time"
+)
+
+// FixedWindowLimiter allows limit requests per key in consecutive windows of
+// the given length, the count starts over when a window ends.
+type FixedWindowLimiter struct {
+	sync.Mutex
+	clients   map[string]*window
+	limit     int
+	window    time.Duration
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type window struct {
+	start time.Time
+	count int
+}
+
+func NewFixedWindowLimiter(limit int, w time.Duration) *FixedWindowLimiter {
+	return &FixedWindowLimiter{
+		clients:   make(map[string]*window),
+		limit:     limit,
+		window:    w,
+		lastSweep: time.Now(),
+		now:       time.Now,
+	}
+}
+
+func (rl *FixedWindowLimiter) Allow(key string) Result {
+	rl.Lock()
+	defer rl.Unlock()
+
+	now := rl.now()
+	rl.sweep(now)
+
+	win, ok := rl.clients[key]
+	if !ok || now.Sub(win.start) >= rl.window {
+		win = &window{start: now}
+		rl.clients[key] = win
+	}
+
+	reset := win.start.Add(rl.window).Sub(now)
+
+	if win.count >= rl.limit {
+		return Result{
+			Allowed:    false,
+			Limit:      rl.limit,
+			Remaining:  0,
+			Reset:      reset,
+			RetryAfter: reset,
+		}
+	}
+
+	win.count++
+
+	return Result{
+		Allowed:   true,
+		Limit:     rl.limit,
+		Remaining: rl.limit - win.count,
+		Reset:     reset,
+	}
+}
+
+// sweep drops the windows that already ended, at most once per window so
+// the cost stays amortised.
+func (rl *FixedWindowLimiter) sweep(now time.Time) {
+	if now.Sub(rl.lastSweep) < rl.window {
+		return
+	}
+
+	for key, win := range rl.clients {
+		if now.Sub(win.start) >= rl.window {
+			delete(rl.clients, key)
+		}
+	}
+
+	rl.lastSweep = now
+}
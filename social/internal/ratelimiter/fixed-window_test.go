@@ -0,0 +1,73 @@
+package ratelimiter
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestFixedWindow(limit int, w time.Duration) (*FixedWindowLimiter, *testClock) {
+	clock := newTestClock()
+
+	rl := NewFixedWindowLimiter(limit, w)
+	rl.now = clock.Now
+	rl.lastSweep = clock.Now()
+
+	return rl, clock
+}
+
+func TestFixedWindowLimiter(t *testing.T) {
+	rl, clock := newTestFixedWindow(2, time.Minute)
+
+	checkResult(t, rl.Allow("a"), Result{Allowed: true, Limit: 2, Remaining: 1, Reset: time.Minute})
+
+	clock.Advance(20 * time.Second)
+	checkResult(t, rl.Allow("a"), Result{Allowed: true, Limit: 2, Remaining: 0, Reset: 40 * time.Second})
+
+	// the window started with the first request
+	clock.Advance(10 * time.Second)
+	checkResult(t, rl.Allow("a"), Result{Allowed: false, Limit: 2, Remaining: 0, Reset: 30 * time.Second, RetryAfter: 30 * time.Second})
+
+	// keys are counted apart
+	checkResult(t, rl.Allow("b"), Result{Allowed: true, Limit: 2, Remaining: 1, Reset: time.Minute})
+
+	clock.Advance(30*time.Second - time.Nanosecond)
+	checkResult(t, rl.Allow("a"), Result{Allowed: false, Limit: 2, Remaining: 0, Reset: time.Nanosecond, RetryAfter: time.Nanosecond})
+
+	// the next window starts with the full allowance
+	clock.Advance(time.Nanosecond)
+	checkResult(t, rl.Allow("a"), Result{Allowed: true, Limit: 2, Remaining: 1, Reset: time.Minute})
+	checkResult(t, rl.Allow("a"), Result{Allowed: true, Limit: 2, Remaining: 0, Reset: time.Minute})
+	checkResult(t, rl.Allow("a"), Result{Allowed: false, Limit: 2, Remaining: 0, Reset: time.Minute, RetryAfter: time.Minute})
+
+	// a window isn't extended by denied requests
+	clock.Advance(time.Minute)
+	checkResult(t, rl.Allow("a"), Result{Allowed: true, Limit: 2, Remaining: 1, Reset: time.Minute})
+}
+
+func TestFixedWindowLimiterSweep(t *testing.T) {
+	rl, clock := newTestFixedWindow(2, time.Minute)
+
+	rl.Allow("ended")
+	clock.Advance(30 * time.Second)
+	rl.Allow("current")
+
+	// sweeping runs once per window
+	clock.Advance(29 * time.Second)
+	rl.Allow("new")
+	if len(rl.clients) != 3 {
+		t.Fatalf("%d windows before a sweep is due, want 3", len(rl.clients))
+	}
+
+	clock.Advance(time.Second)
+	rl.Allow("new")
+
+	if len(rl.clients) != 2 {
+		t.Errorf("%d windows after the sweep, want 2", len(rl.clients))
+	}
+	if _, ok := rl.clients["ended"]; ok {
+		t.Error("the ended window wasn't swept")
+	}
+	if win, ok := rl.clients["current"]; !ok || win.count != 1 {
+		t.Error("the current window was swept or reset")
+	}
+}
@@ -0,0 +1,54 @@
+package ratelimiter
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	StrategyFixedWindow = "fixed-window"
+	StrategyTokenBucket = "token-bucket"
+)
+
+// Limiter decides whether the caller identified by key may make another
+// request right now.
+type Limiter interface {
+	Allow(key string) Result
+}
+
+// Result carries everything needed to fill the Retry-After and X-RateLimit-*
+// response headers.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is how long until the caller has its full allowance back.
+	Reset time.Duration
+	// RetryAfter is how long until the next request would be allowed, it's
+	// zero when Allowed is true.
+	RetryAfter time.Duration
+}
+
+type Config struct {
+	Strategy             string
+	RequestsPerTimeFrame int
+	TimeFrame            time.Duration
+	Enabled              bool
+}
+
+// New builds the limiter selected by cfg.Strategy, defaulting to a fixed
+// window when none is set.
+func New(cfg Config) (Limiter, error) {
+	if cfg.RequestsPerTimeFrame <= 0 || cfg.TimeFrame <= 0 {
+		return nil, fmt.Errorf("ratelimiter: invalid config %d requests per %s", cfg.RequestsPerTimeFrame, cfg.TimeFrame)
+	}
+
+	switch cfg.Strategy {
+	case "", StrategyFixedWindow:
+		return NewFixedWindowLimiter(cfg.RequestsPerTimeFrame, cfg.TimeFrame), nil
+	case StrategyTokenBucket:
+		return NewTokenBucketLimiter(cfg.RequestsPerTimeFrame, cfg.TimeFrame), nil
+	default:
+		return nil, fmt.Errorf("ratelimiter: unknown strategy %q", cfg.Strategy)
+	}
+}
@@ -0,0 +1,57 @@
+package ratelimiter
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// testClock is a clock tests move forward by hand.
+type testClock struct {
+	now time.Time
+}
+
+func newTestClock() *testClock {
+	return &testClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *testClock) Now() time.Time { return c.now }
+
+func (c *testClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func checkResult(t *testing.T, got, want Result) {
+	t.Helper()
+
+	if got != want {
+		t.Errorf("result = %+v, want %+v", got, want)
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		want    string
+		wantErr bool
+	}{
+		{name: "default", cfg: Config{RequestsPerTimeFrame: 1, TimeFrame: time.Second}, want: "*ratelimiter.FixedWindowLimiter"},
+		{name: "fixed window", cfg: Config{Strategy: StrategyFixedWindow, RequestsPerTimeFrame: 1, TimeFrame: time.Second}, want: "*ratelimiter.FixedWindowLimiter"},
+		{name: "token bucket", cfg: Config{Strategy: StrategyTokenBucket, RequestsPerTimeFrame: 1, TimeFrame: time.Second}, want: "*ratelimiter.TokenBucketLimiter"},
+		{name: "unknown strategy", cfg: Config{Strategy: "leaky-bucket", RequestsPerTimeFrame: 1, TimeFrame: time.Second}, wantErr: true},
+		{name: "no requests", cfg: Config{TimeFrame: time.Second}, wantErr: true},
+		{name: "no time frame", cfg: Config{RequestsPerTimeFrame: 1}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := New(tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("New error = %v, want error: %v", err, tt.wantErr)
+			}
+
+			if got := fmt.Sprintf("%T", l); !tt.wantErr && got != tt.want {
+				t.Errorf("New = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package ratelimiter
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// TokenBucketLimiter gives each key a bucket of capacity tokens refilled
+// continuously at capacity per period. Unlike a fixed window it smooths out
+// bursts at window boundaries.
+type TokenBucketLimiter struct {
+	sync.Mutex
+	buckets   map[string]*bucket
+	capacity  float64
+	rate      float64 // tokens per second
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func NewTokenBucketLimiter(capacity int, period time.Duration) *TokenBucketLimiter {
+	return &TokenBucketLimiter{
+		buckets:   make(map[string]*bucket),
+		capacity:  float64(capacity),
+		rate:      float64(capacity) / period.Seconds(),
+		lastSweep: time.Now(),
+		now:       time.Now,
+	}
+}
+
+func (rl *TokenBucketLimiter) Allow(key string) Result {
+	rl.Lock()
+	defer rl.Unlock()
+
+	now := rl.now()
+	rl.sweep(now)
+
+	b, ok := rl.buckets[key]
+	if !ok {
+		b = &bucket{tokens: rl.capacity, last: now}
+		rl.buckets[key] = b
+	}
+
+	b.tokens = math.Min(rl.capacity, b.tokens+now.Sub(b.last).Seconds()*rl.rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		return Result{
+			Allowed:    false,
+			Limit:      int(rl.capacity),
+			Remaining:  0,
+			Reset:      rl.timeToRefill(rl.capacity - b.tokens),
+			RetryAfter: rl.timeToRefill(1 - b.tokens),
+		}
+	}
+
+	b.tokens--
+
+	return Result{
+		Allowed:   true,
+		Limit:     int(rl.capacity),
+		Remaining: int(b.tokens),
+		Reset:     rl.timeToRefill(rl.capacity - b.tokens),
+	}
+}
+
+func (rl *TokenBucketLimiter) timeToRefill(tokens float64) time.Duration {
+	return time.Duration(tokens / rl.rate * float64(time.Second))
+}
+
+// sweep drops buckets that have been idle long enough to be full again,
+// they are indistinguishable from a new bucket.
+func (rl *TokenBucketLimiter) sweep(now time.Time) {
+	full := rl.timeToRefill(rl.capacity)
+	if now.Sub(rl.lastSweep) < full {
+		return
+	}
+
+	for key, b := range rl.buckets {
+		if now.Sub(b.last) >= full {
+			delete(rl.buckets, key)
+		}
+	}
+
+	rl.lastSweep = now
+}
@@ -0,0 +1,69 @@
+package ratelimiter
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestTokenBucket(capacity int, period time.Duration) (*TokenBucketLimiter, *testClock) {
+	clock := newTestClock()
+
+	rl := NewTokenBucketLimiter(capacity, period)
+	rl.now = clock.Now
+	rl.lastSweep = clock.Now()
+
+	return rl, clock
+}
+
+func TestTokenBucketLimiter(t *testing.T) {
+	// a token every 500ms
+	rl, clock := newTestTokenBucket(2, time.Second)
+
+	checkResult(t, rl.Allow("a"), Result{Allowed: true, Limit: 2, Remaining: 1, Reset: 500 * time.Millisecond})
+	checkResult(t, rl.Allow("a"), Result{Allowed: true, Limit: 2, Remaining: 0, Reset: time.Second})
+	checkResult(t, rl.Allow("a"), Result{Allowed: false, Limit: 2, Remaining: 0, Reset: time.Second, RetryAfter: 500 * time.Millisecond})
+
+	// keys have buckets of their own
+	checkResult(t, rl.Allow("b"), Result{Allowed: true, Limit: 2, Remaining: 1, Reset: 500 * time.Millisecond})
+
+	// half a token isn't enough
+	clock.Advance(250 * time.Millisecond)
+	checkResult(t, rl.Allow("a"), Result{Allowed: false, Limit: 2, Remaining: 0, Reset: 750 * time.Millisecond, RetryAfter: 250 * time.Millisecond})
+
+	clock.Advance(250 * time.Millisecond)
+	checkResult(t, rl.Allow("a"), Result{Allowed: true, Limit: 2, Remaining: 0, Reset: time.Second})
+
+	// refilling stops at the capacity
+	clock.Advance(time.Hour)
+	checkResult(t, rl.Allow("a"), Result{Allowed: true, Limit: 2, Remaining: 1, Reset: 500 * time.Millisecond})
+	checkResult(t, rl.Allow("a"), Result{Allowed: true, Limit: 2, Remaining: 0, Reset: time.Second})
+	checkResult(t, rl.Allow("a"), Result{Allowed: false, Limit: 2, Remaining: 0, Reset: time.Second, RetryAfter: 500 * time.Millisecond})
+}
+
+func TestTokenBucketLimiterSweep(t *testing.T) {
+	rl, clock := newTestTokenBucket(2, time.Second)
+
+	rl.Allow("full")
+	clock.Advance(500 * time.Millisecond)
+	rl.Allow("refilling")
+
+	// sweeping runs once per full refill
+	clock.Advance(499 * time.Millisecond)
+	rl.Allow("new")
+	if len(rl.buckets) != 3 {
+		t.Fatalf("%d buckets before a sweep is due, want 3", len(rl.buckets))
+	}
+
+	clock.Advance(time.Millisecond)
+	rl.Allow("new")
+
+	if len(rl.buckets) != 2 {
+		t.Errorf("%d buckets after the sweep, want 2", len(rl.buckets))
+	}
+	if _, ok := rl.buckets["full"]; ok {
+		t.Error("the full bucket wasn't swept")
+	}
+	if _, ok := rl.buckets["refilling"]; !ok {
+		t.Error("the refilling bucket was swept")
+	}
+}
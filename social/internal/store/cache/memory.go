@@ -0,0 +1,119 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"social/internal/store"
+	"sync"
+	"time"
+)
+
+// NewInMemoryStorage keeps entries in the process memory. Each API replica
+// gets its own copy, so it's meant for local runs and single instance
+// deployments where running Redis isn't worth it.
+func NewInMemoryStorage(ttl time.Duration) Storage {
+	return Storage{
+		Users: &InMemoryUserStore{
+			ttl:        ttl,
+			maxEntries: maxInMemoryEntries,
+			now:        time.Now,
+			order:      list.New(),
+			users:      make(map[int64]*list.Element),
+			usernames:  make(map[string]int64),
+		},
+	}
+}
+
+const maxInMemoryEntries = 10_000
+
+type cachedUser struct {
+	user      store.User
+	expiresAt time.Time
+}
+
+// InMemoryUserStore holds at most maxEntries users, evicting the least
+// recently used one to make room.
+type InMemoryUserStore struct {
+	mu         sync.Mutex
+	ttl        time.Duration
+	maxEntries int
+	now        func() time.Time
+	// most recently used first, the elements hold a cachedUser
+	order     *list.List
+	users     map[int64]*list.Element
+	usernames map[string]int64
+}
+
+func (s *InMemoryUserStore) Get(ctx context.Context, userID int64) (*store.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elem, ok := s.users[userID]
+	if !ok {
+		return nil, nil
+	}
+
+	entry := elem.Value.(cachedUser)
+	if s.now().After(entry.expiresAt) {
+		s.remove(elem)
+		return nil, nil
+	}
+
+	s.order.MoveToFront(elem)
+
+	// hand out a copy so callers can't modify the cached value
+	user := entry.user
+	return &user, nil
+}
+
+// GetIDByUsername only knows the usernames of the users cached, so it's
+// bounded along with them.
+func (s *InMemoryUserStore) GetIDByUsername(ctx context.Context, username string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.usernames[username], nil
+}
+
+func (s *InMemoryUserStore) Set(ctx context.Context, user *store.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry := cachedUser{
+		user:      *user,
+		expiresAt: s.now().Add(s.ttl),
+	}
+
+	if elem, ok := s.users[user.ID]; ok {
+		s.remove(elem)
+	} else if s.order.Len() >= s.maxEntries {
+		s.remove(s.order.Back())
+	}
+
+	s.users[user.ID] = s.order.PushFront(entry)
+	s.usernames[user.Username] = user.ID
+
+	return nil
+}
+
+func (s *InMemoryUserStore) Delete(ctx context.Context, userID int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if elem, ok := s.users[userID]; ok {
+		s.remove(elem)
+	}
+}
+
+// remove must be called with mu held.
+func (s *InMemoryUserStore) remove(elem *list.Element) {
+	user := elem.Value.(cachedUser).user
+
+	s.order.Remove(elem)
+	delete(s.users, user.ID)
+
+	// the username may have moved on to another cached user since
+	if s.usernames[user.Username] == user.ID {
+		delete(s.usernames, user.Username)
+	}
+}
@@ -0,0 +1,157 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"social/internal/store"
+	"testing"
+	"time"
+)
+
+// testClock is a clock tests move forward by hand.
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time { return c.now }
+
+func (c *testClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func newTestInMemoryStore(ttl time.Duration, maxEntries int) (*InMemoryUserStore, *testClock) {
+	clock := &testClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+	s := NewInMemoryStorage(ttl).Users.(*InMemoryUserStore)
+	s.maxEntries = maxEntries
+	s.now = clock.Now
+
+	return s, clock
+}
+
+func TestInMemoryUserStoreRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestInMemoryStore(time.Minute, 10)
+
+	user, err := s.Get(ctx, 1)
+	if user != nil || err != nil {
+		t.Fatalf("Get on a miss = %v, %v, want nil, nil", user, err)
+	}
+
+	if err := s.Set(ctx, &store.User{ID: 1, Username: "gopher"}); err != nil {
+		t.Fatal(err)
+	}
+
+	user, err = s.Get(ctx, 1)
+	if err != nil || user == nil || user.Username != "gopher" {
+		t.Fatalf("Get = %v, %v, want gopher", user, err)
+	}
+
+	// callers get a copy
+	user.Username = "changed"
+	if again, _ := s.Get(ctx, 1); again.Username != "gopher" {
+		t.Errorf("cached user modified through Get, username = %q", again.Username)
+	}
+
+	if id, _ := s.GetIDByUsername(ctx, "gopher"); id != 1 {
+		t.Errorf("GetIDByUsername = %d, want 1", id)
+	}
+
+	s.Delete(ctx, 1)
+
+	if user, _ := s.Get(ctx, 1); user != nil {
+		t.Errorf("Get after Delete = %v, want nil", user)
+	}
+	if id, _ := s.GetIDByUsername(ctx, "gopher"); id != 0 {
+		t.Errorf("GetIDByUsername after Delete = %d, want 0", id)
+	}
+}
+
+func TestInMemoryUserStoreExpiry(t *testing.T) {
+	ctx := context.Background()
+	s, clock := newTestInMemoryStore(time.Minute, 10)
+
+	s.Set(ctx, &store.User{ID: 1, Username: "gopher"})
+
+	clock.Advance(time.Minute)
+	if user, _ := s.Get(ctx, 1); user == nil {
+		t.Fatal("expired at exactly the TTL, want it kept until after")
+	}
+
+	clock.Advance(time.Second)
+	if user, _ := s.Get(ctx, 1); user != nil {
+		t.Fatalf("Get after the TTL = %v, want nil", user)
+	}
+
+	if n := s.order.Len(); n != 0 {
+		t.Errorf("%d entries left after expiry, want 0", n)
+	}
+	if id, _ := s.GetIDByUsername(ctx, "gopher"); id != 0 {
+		t.Errorf("GetIDByUsername after expiry = %d, want 0", id)
+	}
+}
+
+func TestInMemoryUserStoreEviction(t *testing.T) {
+	tests := []struct {
+		name string
+		// touched are read after filling the cache, making them the most
+		// recently used
+		touched     []int64
+		wantEvicted int64
+	}{
+		{name: "oldest first", wantEvicted: 1},
+		{name: "read entries are kept", touched: []int64{1}, wantEvicted: 2},
+		{name: "least recently read", touched: []int64{1, 2, 3}, wantEvicted: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			s, _ := newTestInMemoryStore(time.Minute, 3)
+
+			for id := int64(1); id <= 3; id++ {
+				s.Set(ctx, &store.User{ID: id, Username: fmt.Sprintf("user%d", id)})
+			}
+			for _, id := range tt.touched {
+				s.Get(ctx, id)
+			}
+
+			s.Set(ctx, &store.User{ID: 4, Username: "user4"})
+
+			if n := s.order.Len(); n != 3 {
+				t.Fatalf("%d entries, want the capacity of 3", n)
+			}
+			if len(s.users) != 3 || len(s.usernames) != 3 {
+				t.Errorf("%d users and %d usernames indexed, want 3 each", len(s.users), len(s.usernames))
+			}
+
+			for id := int64(1); id <= 4; id++ {
+				user, _ := s.Get(ctx, id)
+				if evicted := user == nil; evicted != (id == tt.wantEvicted) {
+					t.Errorf("user %d evicted = %v, want %v", id, evicted, id == tt.wantEvicted)
+				}
+			}
+		})
+	}
+}
+
+func TestInMemoryUserStoreSetExisting(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestInMemoryStore(time.Minute, 2)
+
+	s.Set(ctx, &store.User{ID: 1, Username: "old"})
+	s.Set(ctx, &store.User{ID: 2, Username: "other"})
+	// replacing an entry must not evict another one
+	s.Set(ctx, &store.User{ID: 1, Username: "new"})
+
+	if n := s.order.Len(); n != 2 {
+		t.Fatalf("%d entries, want 2", n)
+	}
+	if user, _ := s.Get(ctx, 2); user == nil {
+		t.Error("user 2 evicted by replacing user 1")
+	}
+	if id, _ := s.GetIDByUsername(ctx, "old"); id != 0 {
+		t.Errorf("old username still maps to %d", id)
+	}
+	if id, _ := s.GetIDByUsername(ctx, "new"); id != 1 {
+		t.Errorf("GetIDByUsername(new) = %d, want 1", id)
+	}
+}
@@ -0,0 +1,82 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"social/internal/store"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const UserExpTime = time.Minute
+
+func NewRedisClient(addr, pw string, db int) *redis.Client {
+	return redis.NewClient(&redis.Options{
+		Addr:     addr,
+		Password: pw,
+		DB:       db,
+	})
+}
+
+func NewRedisStorage(rdb *redis.Client) Storage {
+	return Storage{
+		Users: &RedisUserStore{rdb: rdb},
+	}
+}
+
+type RedisUserStore struct {
+	rdb *redis.Client
+}
+
+func (s *RedisUserStore) Get(ctx context.Context, userID int64) (*store.User, error) {
+	data, err := s.rdb.Get(ctx, userCacheKey(userID)).Result()
+	if err == redis.Nil {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var user store.User
+	if err := json.Unmarshal([]byte(data), &user); err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func (s *RedisUserStore) GetIDByUsername(ctx context.Context, username string) (int64, error) {
+	userID, err := s.rdb.Get(ctx, usernameCacheKey(username)).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+
+	return userID, err
+}
+
+func (s *RedisUserStore) Set(ctx context.Context, user *store.User) error {
+	data, err := json.Marshal(user)
+	if err != nil {
+		return err
+	}
+
+	pipe := s.rdb.TxPipeline()
+	pipe.SetEx(ctx, userCacheKey(user.ID), data, UserExpTime)
+	pipe.SetEx(ctx, usernameCacheKey(user.Username), user.ID, UserExpTime)
+	_, err = pipe.Exec(ctx)
+
+	return err
+}
+
+func (s *RedisUserStore) Delete(ctx context.Context, userID int64) {
+	s.rdb.Del(ctx, userCacheKey(userID))
+}
+
+func userCacheKey(userID int64) string {
+	return fmt.Sprintf("user-%d", userID)
+}
+
+func usernameCacheKey(username string) string {
+	return "username-" + username
+}
@@ -0,0 +1,102 @@
+package cache
+
+import (
+	"context"
+	"social/internal/store"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func newTestRedisStore(t *testing.T) (*RedisUserStore, *miniredis.Miniredis) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+
+	rdb := NewRedisClient(mr.Addr(), "", 0)
+	t.Cleanup(func() { rdb.Close() })
+
+	return NewRedisStorage(rdb).Users.(*RedisUserStore), mr
+}
+
+func TestRedisUserStoreRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestRedisStore(t)
+
+	user, err := s.Get(ctx, 1)
+	if user != nil || err != nil {
+		t.Fatalf("Get on a miss = %v, %v, want nil, nil", user, err)
+	}
+
+	id, err := s.GetIDByUsername(ctx, "gopher")
+	if id != 0 || err != nil {
+		t.Fatalf("GetIDByUsername on a miss = %d, %v, want 0, nil", id, err)
+	}
+
+	want := &store.User{ID: 1, Username: "gopher", Email: "gopher@example.com", IsActive: true}
+	if err := s.Set(ctx, want); err != nil {
+		t.Fatal(err)
+	}
+
+	user, err = s.Get(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user == nil || user.ID != want.ID || user.Username != want.Username || user.Email != want.Email || !user.IsActive {
+		t.Errorf("Get = %+v, want %+v", user, want)
+	}
+
+	id, err = s.GetIDByUsername(ctx, "gopher")
+	if id != 1 || err != nil {
+		t.Errorf("GetIDByUsername = %d, %v, want 1, nil", id, err)
+	}
+
+	s.Delete(ctx, 1)
+
+	user, err = s.Get(ctx, 1)
+	if user != nil || err != nil {
+		t.Errorf("Get after Delete = %v, %v, want nil, nil", user, err)
+	}
+}
+
+func TestRedisUserStoreExpiry(t *testing.T) {
+	ctx := context.Background()
+	s, mr := newTestRedisStore(t)
+
+	if err := s.Set(ctx, &store.User{ID: 1, Username: "gopher"}); err != nil {
+		t.Fatal(err)
+	}
+
+	mr.FastForward(UserExpTime - time.Second)
+	if user, _ := s.Get(ctx, 1); user == nil {
+		t.Fatal("expired before UserExpTime")
+	}
+
+	mr.FastForward(time.Second)
+
+	user, err := s.Get(ctx, 1)
+	if user != nil || err != nil {
+		t.Errorf("Get after UserExpTime = %v, %v, want nil, nil", user, err)
+	}
+
+	id, err := s.GetIDByUsername(ctx, "gopher")
+	if id != 0 || err != nil {
+		t.Errorf("GetIDByUsername after UserExpTime = %d, %v, want 0, nil", id, err)
+	}
+}
+
+func TestRedisUserStoreUnavailable(t *testing.T) {
+	ctx := context.Background()
+	s, mr := newTestRedisStore(t)
+
+	mr.Close()
+
+	// failures have to be told apart from misses
+	if _, err := s.Get(ctx, 1); err == nil {
+		t.Error("Get with Redis down returned no error")
+	}
+	if err := s.Set(ctx, &store.User{ID: 1}); err == nil {
+		t.Error("Set with Redis down returned no error")
+	}
+}
@@ -0,0 +1,20 @@
+package cache
+
+import (
+	"context"
+	"social/internal/store"
+)
+
+// Storage caches hot lookups in front of store.Storage. A miss is reported as
+// a nil value with a nil error, so callers can tell it apart from a failure.
+type Storage struct {
+	Users interface {
+		Get(context.Context, int64) (*store.User, error)
+		// GetIDByUsername returns the id of the user cached under the
+		// username, 0 on a miss. The mapping is only as fresh as the last
+		// Set, callers have to check the username of the user they get.
+		GetIDByUsername(context.Context, string) (int64, error)
+		Set(context.Context, *store.User) error
+		Delete(context.Context, int64)
+	}
+}
@@ -3,75 +3,397 @@ package store
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/lib/pq"
 )
 
 type Comment struct {
 	ID        int64  `json:"id"`
 	PostID    int64  `json:"post_id"`
 	UserID    int64  `json:"user_id"`
+	ParentID  *int64 `json:"parent_id"`
 	Content   string `json:"content"`
 	CreatedAt string `json:"created_at"`
 	User      User   `json:"user"`
+	// only set when listing comments, ReplyCount also counts the replies
+	// that weren't loaded
+	ReplyCount int       `json:"reply_count"`
+	Replies    []Comment `json:"replies,omitempty"`
+}
+
+// CommentThreadQuery selects the part of a post's comment tree to load:
+// the replies to ParentID, or the top level comments when it's nil, down to
+// MaxDepth levels. Deeper threads are expanded by loading them again from
+// the deepest comment loaded. The pagination applies to the first level.
+type CommentThreadQuery struct {
+	PaginatedCommentsQuery
+	ParentID *int64 `json:"parent"`
+	MaxDepth int    `json:"depth" validate:"gte=1,lte=10"`
 }
 
+func (q CommentThreadQuery) Parse(r *http.Request) (CommentThreadQuery, error) {
+	page, err := q.PaginatedCommentsQuery.Parse(r)
+	if err != nil {
+		return q, err
+	}
+	q.PaginatedCommentsQuery = page
+
+	qs := r.URL.Query()
+
+	parent := qs.Get("parent")
+	if parent != "" {
+		p, err := strconv.ParseInt(parent, 10, 64)
+		if err != nil {
+			return q, invalidQuery("invalid parent %q: must be a comment id", parent)
+		}
+
+		q.ParentID = &p
+	}
+
+	depth := qs.Get("depth")
+	if depth != "" {
+		d, err := strconv.Atoi(depth)
+		if err != nil {
+			return q, invalidQuery("invalid depth %q: must be an integer", depth)
+		}
+
+		q.MaxDepth = d
+	}
+
+	return q, nil
+}
+
+const (
+	// MaxThreadReplies is how many replies of a comment GetThread loads.
+	MaxThreadReplies = 10
+	// MaxThreadComments is how many comments GetThread loads in all.
+	MaxThreadComments = 500
+)
+
 type CommentStore struct {
 	db *sql.DB
 }
 
-func (s *CommentStore) GetByPostID(ctx context.Context, postID int64) ([]Comment, error) {
+// GetByPostID returns a page of the top level comments of a post, oldest
+// first, without their replies.
+func (s *CommentStore) GetByPostID(ctx context.Context, postID int64, q PaginatedCommentsQuery) (comments []Comment, err error) {
+	ctx, span := startQuery(ctx, "CommentStore.GetByPostID")
+	defer span.end(&err)
+
+	afterCreatedAt, afterID := q.after()
+
 	query := `
-		SELECT c.id, c.post_id, c.user_id, c.content, c.created_at, users.username, users.id  FROM comments c
+		SELECT c.id, c.post_id, c.user_id, c.parent_id, c.content, c.created_at, users.username, users.id,
+			(SELECT COUNT(*) FROM comments r WHERE r.parent_id = c.id) AS reply_count
+		FROM comments c
 		JOIN users on users.id = c.user_id
-		WHERE c.post_id = $1
-		ORDER BY c.created_at DESC;
+		WHERE c.post_id = $1 AND c.parent_id IS NULL AND
+			($3::timestamptz IS NULL OR (c.created_at, c.id) > ($3, $4::bigint))
+		ORDER BY c.created_at, c.id
+		LIMIT $2
 	`
 
-	// ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
-	// defer cancel()
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
 
-	rows, err := s.db.QueryContext(ctx, query, postID)
+	rows, err := s.db.QueryContext(ctx, query, postID, q.Limit, afterCreatedAt, afterID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	comments := []Comment{}
+	comments = []Comment{}
 	for rows.Next() {
 		var c Comment
 		c.User = User{}
-		err := rows.Scan(&c.ID, &c.PostID, &c.UserID, &c.Content, &c.CreatedAt, &c.User.Username, &c.User.ID)
+		err := rows.Scan(&c.ID, &c.PostID, &c.UserID, &c.ParentID, &c.Content, &c.CreatedAt, &c.User.Username, &c.User.ID, &c.ReplyCount)
 		if err != nil {
 			return nil, err
 		}
 		comments = append(comments, c)
 	}
 
-	return comments, nil
+	span.setRows(int64(len(comments)))
+
+	return comments, rows.Err()
+}
+
+// CountByPostID counts all the comments of a post, replies included.
+func (s *CommentStore) CountByPostID(ctx context.Context, postID int64) (count int, err error) {
+	ctx, span := startQuery(ctx, "CommentStore.CountByPostID")
+	defer span.end(&err)
+
+	query := `SELECT COUNT(*) FROM comments WHERE post_id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err = s.db.QueryRowContext(ctx, query, postID).Scan(&count)
+	return count, err
 }
 
-func (s *CommentStore) Create(ctx context.Context, comment *Comment) error {
+func (s *CommentStore) Create(ctx context.Context, comment *Comment) (err error) {
+	ctx, span := startQuery(ctx, "CommentStore.Create")
+	defer span.end(&err)
+
+	// a reply is only inserted when its parent is on the same post
 	query := `
-		INSERT INTO comments (post_id, user_id, content)
-		VALUES ($1, $2, $3)
+		INSERT INTO comments (post_id, user_id, content, parent_id)
+		SELECT $1, $2, $3, $4
+		WHERE $4::bigint IS NULL OR EXISTS (SELECT 1 FROM comments WHERE id = $4 AND post_id = $1)
 		RETURNING id, created_at
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	err := s.db.QueryRowContext(
+	err = s.db.QueryRowContext(
 		ctx,
 		query,
 		comment.PostID,
 		comment.UserID,
 		comment.Content,
+		comment.ParentID,
 	).Scan(
 		&comment.ID,
 		&comment.CreatedAt,
 	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		// the post or parent was deleted in the meantime
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" {
+			return ErrNotFound
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (s *CommentStore) GetByID(ctx context.Context, id int64) (comment *Comment, err error) {
+	ctx, span := startQuery(ctx, "CommentStore.GetByID")
+	defer span.end(&err)
+
+	query := `
+		SELECT c.id, c.post_id, c.user_id, c.parent_id, c.content, c.created_at, u.username, u.id
+		FROM comments c
+		JOIN users u ON u.id = c.user_id
+		WHERE c.id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	comment = &Comment{}
+	err = s.db.QueryRowContext(ctx, query, id).Scan(
+		&comment.ID,
+		&comment.PostID,
+		&comment.UserID,
+		&comment.ParentID,
+		&comment.Content,
+		&comment.CreatedAt,
+		&comment.User.Username,
+		&comment.User.ID,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return comment, nil
+}
+
+// Update saves the comment's content, the only part of a comment that can
+// change.
+func (s *CommentStore) Update(ctx context.Context, comment *Comment) (err error) {
+	ctx, span := startQuery(ctx, "CommentStore.Update")
+	defer span.end(&err)
+
+	query := `UPDATE comments SET content = $1 WHERE id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, comment.Content, comment.ID)
 	if err != nil {
 		return err
 	}
 
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
 	return nil
 }
+
+// Delete removes the comment along with all of its replies.
+func (s *CommentStore) Delete(ctx context.Context, id int64) (err error) {
+	ctx, span := startQuery(ctx, "CommentStore.Delete")
+	defer span.end(&err)
+
+	query := `DELETE FROM comments WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	span.setRows(rows)
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// GetThread loads the comment tree of a post selected by q, every level
+// sorted oldest first. Below the first level only the oldest
+// MaxThreadReplies replies of a comment are loaded, and the whole tree stops
+// at MaxThreadComments comments. The rest is loaded with the comment as
+// ParentID, its ReplyCount tells when there's more.
+func (s *CommentStore) GetThread(ctx context.Context, postID int64, q CommentThreadQuery) (thread []Comment, err error) {
+	ctx, span := startQuery(ctx, "CommentStore.GetThread")
+	defer span.end(&err)
+
+	query := `
+		WITH RECURSIVE thread AS (
+			(
+				SELECT id, 1 AS depth
+				FROM comments
+				WHERE post_id = $1 AND (($2::bigint IS NULL AND parent_id IS NULL) OR parent_id = $2) AND
+					($5::timestamptz IS NULL OR (created_at, id) > ($5, $6::bigint))
+				ORDER BY created_at, id
+				LIMIT $4
+			)
+			UNION ALL
+			SELECT r.id, t.depth + 1
+			FROM thread t
+			CROSS JOIN LATERAL (
+				SELECT id
+				FROM comments
+				WHERE parent_id = t.id
+				ORDER BY created_at, id
+				LIMIT $7
+			) r
+			WHERE t.depth < $3
+		),
+		-- the thread is built a level at a time, so the cap cuts into the
+		-- deepest level loaded and never leaves a reply without its parent
+		capped AS (
+			SELECT id FROM thread LIMIT $8
+		)
+		SELECT c.id, c.post_id, c.user_id, c.parent_id, c.content, c.created_at, u.username, u.id,
+			(SELECT COUNT(*) FROM comments r WHERE r.parent_id = c.id) AS reply_count
+		FROM capped t
+		JOIN comments c ON c.id = t.id
+		JOIN users u ON u.id = c.user_id
+		ORDER BY c.created_at, c.id
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	afterCreatedAt, afterID := q.after()
+
+	rows, err := s.db.QueryContext(
+		ctx,
+		query,
+		postID,
+		q.ParentID,
+		q.MaxDepth,
+		q.Limit,
+		afterCreatedAt,
+		afterID,
+		MaxThreadReplies,
+		MaxThreadComments,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var flat []Comment
+	for rows.Next() {
+		var c Comment
+		err := rows.Scan(
+			&c.ID,
+			&c.PostID,
+			&c.UserID,
+			&c.ParentID,
+			&c.Content,
+			&c.CreatedAt,
+			&c.User.Username,
+			&c.User.ID,
+			&c.ReplyCount,
+		)
+		if err != nil {
+			return nil, err
+		}
+		flat = append(flat, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	span.setRows(int64(len(flat)))
+
+	return commentTree(flat, q.ParentID), nil
+}
+
+// commentTree nests comments under their parents, keeping the order of
+// flat within each level. The roots are the replies to parentID.
+func commentTree(flat []Comment, parentID *int64) []Comment {
+	var root int64
+	if parentID != nil {
+		root = *parentID
+	}
+
+	// comment ids start at 1, so 0 can stand for "no parent"
+	children := make(map[int64][]Comment)
+	for _, c := range flat {
+		var parent int64
+		if c.ParentID != nil {
+			parent = *c.ParentID
+		}
+		children[parent] = append(children[parent], c)
+	}
+
+	var nest func(parent int64) []Comment
+	nest = func(parent int64) []Comment {
+		level := children[parent]
+		for i := range level {
+			level[i].Replies = nest(level[i].ID)
+		}
+		return level
+	}
+
+	thread := nest(root)
+	if thread == nil {
+		thread = []Comment{}
+	}
+
+	return thread
+}
@@ -0,0 +1,246 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// addReplies adds n replies to each of parents, or n top level comments
+// without parents, and returns their ids.
+func addReplies(t *testing.T, s *CommentStore, post *Post, parents []int64, n int) []int64 {
+	t.Helper()
+
+	if parents == nil {
+		parents = []int64{0}
+	}
+
+	var ids []int64
+	for _, parent := range parents {
+		for range n {
+			c := &Comment{PostID: post.ID, UserID: post.UserID, Content: "comment"}
+			if parent != 0 {
+				c.ParentID = &parent
+			}
+
+			if err := s.Create(context.Background(), c); err != nil {
+				t.Fatalf("creating comment: %v", err)
+			}
+			ids = append(ids, c.ID)
+		}
+	}
+
+	return ids
+}
+
+// walkThread calls fn for every comment of the thread, parents first.
+func walkThread(thread []Comment, fn func(c Comment, depth int)) {
+	var walk func(level []Comment, depth int)
+	walk = func(level []Comment, depth int) {
+		for _, c := range level {
+			fn(c, depth)
+			walk(c.Replies, depth+1)
+		}
+	}
+	walk(thread, 1)
+}
+
+func TestGetThreadReplyCap(t *testing.T) {
+	db := newTestDB(t)
+	post := newTestPost(t, db)
+	s := &CommentStore{db}
+
+	roots := addReplies(t, s, post, nil, 1)
+	replies := addReplies(t, s, post, roots, MaxThreadReplies+2)
+	addReplies(t, s, post, replies, 1)
+
+	q := CommentThreadQuery{PaginatedCommentsQuery: PaginatedCommentsQuery{Limit: 10}, MaxDepth: 3}
+
+	thread, err := s.GetThread(context.Background(), post.ID, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(thread) != 1 {
+		t.Fatalf("%d top level comments, want 1", len(thread))
+	}
+
+	root := thread[0]
+	if root.ReplyCount != MaxThreadReplies+2 {
+		t.Errorf("reply_count = %d, want %d", root.ReplyCount, MaxThreadReplies+2)
+	}
+	if len(root.Replies) != MaxThreadReplies {
+		t.Fatalf("%d replies loaded, want %d", len(root.Replies), MaxThreadReplies)
+	}
+
+	// the oldest replies are the ones loaded
+	for i, reply := range root.Replies {
+		if reply.ID != replies[i] {
+			t.Errorf("reply %d is comment %d, want %d", i, reply.ID, replies[i])
+		}
+		if len(reply.Replies) != 1 {
+			t.Errorf("reply %d has %d replies loaded, want 1", i, len(reply.Replies))
+		}
+	}
+
+	// the rest of the replies are loaded with the root as the parent
+	q.ParentID = &root.ID
+
+	rest, err := s.GetThread(context.Background(), post.ID, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rest) != 10 {
+		t.Errorf("%d replies listed by parent, want the page of 10", len(rest))
+	}
+}
+
+func TestGetThreadCommentCap(t *testing.T) {
+	db := newTestDB(t)
+	post := newTestPost(t, db)
+	s := &CommentStore{db}
+
+	// 1 + 10 + 100 comments over three levels and 1000 more on the fourth
+	level := addReplies(t, s, post, nil, 1)
+	for range 3 {
+		level = addReplies(t, s, post, level, MaxThreadReplies)
+	}
+
+	q := CommentThreadQuery{PaginatedCommentsQuery: PaginatedCommentsQuery{Limit: 10}, MaxDepth: 4}
+
+	thread, err := s.GetThread(context.Background(), post.ID, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	perDepth := make(map[int]int)
+	walkThread(thread, func(c Comment, depth int) {
+		perDepth[depth]++
+	})
+
+	// every comment returned is nested under its parent, so counting the
+	// tree also checks none was cut off from it
+	total := 0
+	for _, n := range perDepth {
+		total += n
+	}
+	if total != MaxThreadComments {
+		t.Errorf("%d comments in the tree, want %d", total, MaxThreadComments)
+	}
+
+	// the cap cuts into the deepest level only
+	for depth, want := range map[int]int{1: 1, 2: 10, 3: 100} {
+		if perDepth[depth] != want {
+			t.Errorf("%d comments at depth %d, want %d", perDepth[depth], depth, want)
+		}
+	}
+}
+
+// threadShape writes a thread as "id#reply_count(replies)", leaving out
+// zero reply counts, e.g. "1#2(2 3) 4".
+func threadShape(thread []Comment) string {
+	parts := make([]string, len(thread))
+	for i, c := range thread {
+		part := fmt.Sprint(c.ID)
+		if c.ReplyCount > 0 {
+			part += fmt.Sprintf("#%d", c.ReplyCount)
+		}
+		if len(c.Replies) > 0 {
+			part += "(" + threadShape(c.Replies) + ")"
+		}
+		parts[i] = part
+	}
+
+	return strings.Join(parts, " ")
+}
+
+func TestCommentTree(t *testing.T) {
+	// comment returns a row as GetThread scans it, parent 0 is none
+	comment := func(id, parent int64, replyCount int) Comment {
+		c := Comment{ID: id, ReplyCount: replyCount}
+		if parent != 0 {
+			c.ParentID = &parent
+		}
+		return c
+	}
+	parentID := func(id int64) *int64 { return &id }
+
+	tests := []struct {
+		name     string
+		flat     []Comment
+		parentID *int64
+		want     string
+	}{
+		{
+			name: "empty",
+			want: "",
+		},
+		{
+			name: "nested",
+			flat: []Comment{
+				comment(1, 0, 2), comment(2, 1, 1), comment(3, 1, 0), comment(4, 2, 0), comment(5, 0, 0),
+			},
+			want: "1#2(2#1(4) 3) 5",
+		},
+		{
+			name: "replies before their parents",
+			flat: []Comment{
+				comment(4, 2, 0), comment(3, 1, 0), comment(2, 1, 1), comment(1, 0, 2),
+			},
+			want: "1#2(3 2#1(4))",
+		},
+		{
+			name: "level order kept",
+			flat: []Comment{
+				comment(9, 0, 2), comment(1, 0, 0), comment(7, 9, 0), comment(3, 9, 0),
+			},
+			want: "9#2(7 3) 1",
+		},
+		{
+			name: "orphans dropped",
+			flat: []Comment{
+				comment(1, 0, 0), comment(2, 42, 0), comment(3, 2, 0),
+			},
+			want: "1",
+		},
+		{
+			// the deepest level loaded keeps its reply counts, telling
+			// clients there's more to expand
+			name: "truncated at max depth",
+			flat: []Comment{
+				comment(1, 0, 1), comment(2, 1, 3), comment(3, 0, 0),
+			},
+			want: "1#1(2#3) 3",
+		},
+		{
+			name: "replies to a parent",
+			flat: []Comment{
+				comment(2, 1, 1), comment(3, 1, 0), comment(4, 2, 0),
+			},
+			parentID: parentID(1),
+			want:     "2#1(4) 3",
+		},
+		{
+			name: "top level comments skipped under a parent",
+			flat: []Comment{
+				comment(1, 0, 0), comment(2, 1, 0),
+			},
+			parentID: parentID(1),
+			want:     "2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			thread := commentTree(tt.flat, tt.parentID)
+
+			if thread == nil {
+				t.Fatal("thread is nil, want an empty slice for the JSON")
+			}
+			if got := threadShape(thread); got != tt.want {
+				t.Errorf("thread = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
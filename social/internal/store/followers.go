@@ -0,0 +1,160 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+)
+
+// Follower is a user on either side of a follow relationship, along with
+// when the relationship started.
+type Follower struct {
+	UserID     int64  `json:"user_id"`
+	Username   string `json:"username"`
+	FollowedAt string `json:"followed_at"`
+}
+
+type FollowerStore struct {
+	db *sql.DB
+}
+
+// Follow makes followerID follow userID. Following someone twice returns
+// ErrConflict and following a user that doesn't exist returns ErrNotFound.
+func (s *FollowerStore) Follow(ctx context.Context, followerID, userID int64) (err error) {
+	ctx, span := startQuery(ctx, "FollowerStore.Follow")
+	defer span.end(&err)
+
+	query := `
+		INSERT INTO followers (user_id, follower_id) VALUES ($1, $2)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err = s.db.ExecContext(ctx, query, userID, followerID)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok {
+			switch pqErr.Code {
+			case "23505": // unique_violation
+				return ErrConflict
+			case "23503": // foreign_key_violation
+				return ErrNotFound
+			}
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (s *FollowerStore) Unfollow(ctx context.Context, followerID, userID int64) (err error) {
+	ctx, span := startQuery(ctx, "FollowerStore.Unfollow")
+	defer span.end(&err)
+
+	query := `
+		DELETE FROM followers
+		WHERE user_id = $1 AND follower_id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, userID, followerID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	span.setRows(rows)
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// ListFollowers returns the users following userID, newest first.
+func (s *FollowerStore) ListFollowers(ctx context.Context, userID int64, q PaginatedQuery) (followers []Follower, err error) {
+	ctx, span := startQuery(ctx, "FollowerStore.ListFollowers")
+	defer span.end(&err)
+
+	query := `
+		SELECT u.id, u.username, f.created_at
+		FROM followers f
+		JOIN users u ON u.id = f.follower_id
+		WHERE f.user_id = $1
+		ORDER BY f.created_at DESC, u.id
+		LIMIT $2 OFFSET $3
+	`
+
+	followers, err = s.list(ctx, query, userID, q)
+	span.setRows(int64(len(followers)))
+
+	return followers, err
+}
+
+// ListFollowing returns the users userID follows, newest first.
+func (s *FollowerStore) ListFollowing(ctx context.Context, userID int64, q PaginatedQuery) (following []Follower, err error) {
+	ctx, span := startQuery(ctx, "FollowerStore.ListFollowing")
+	defer span.end(&err)
+
+	query := `
+		SELECT u.id, u.username, f.created_at
+		FROM followers f
+		JOIN users u ON u.id = f.user_id
+		WHERE f.follower_id = $1
+		ORDER BY f.created_at DESC, u.id
+		LIMIT $2 OFFSET $3
+	`
+
+	following, err = s.list(ctx, query, userID, q)
+	span.setRows(int64(len(following)))
+
+	return following, err
+}
+
+func (s *FollowerStore) list(ctx context.Context, query string, userID int64, q PaginatedQuery) ([]Follower, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, q.Limit, q.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	followers := []Follower{}
+	for rows.Next() {
+		var f Follower
+		if err := rows.Scan(&f.UserID, &f.Username, &f.FollowedAt); err != nil {
+			return nil, err
+		}
+		followers = append(followers, f)
+	}
+
+	return followers, rows.Err()
+}
+
+// Counts returns how many users follow userID and how many it follows.
+func (s *FollowerStore) Counts(ctx context.Context, userID int64) (followers, following int64, err error) {
+	ctx, span := startQuery(ctx, "FollowerStore.Counts")
+	defer span.end(&err)
+
+	query := `
+		SELECT
+			(SELECT COUNT(*) FROM followers WHERE user_id = $1),
+			(SELECT COUNT(*) FROM followers WHERE follower_id = $1)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err = s.db.QueryRowContext(ctx, query, userID).Scan(&followers, &following)
+	return followers, following, err
+}
@@ -0,0 +1,97 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	queryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "social",
+		Subsystem: "store",
+		Name:      "query_duration_seconds",
+		Help:      "Time spent in a store method, labelled by method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method"})
+
+	queryErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "social",
+		Subsystem: "store",
+		Name:      "query_errors_total",
+		Help:      "Store method calls that failed unexpectedly, labelled by method.",
+	}, []string{"method"})
+
+	// the tracer provider is looked up when the span starts, so whatever
+	// the API registers with otel.SetTracerProvider is used
+	tracer = otel.Tracer("social/internal/store")
+)
+
+// querySpan instruments a single store method call: it's a child span of the
+// caller's span and an observation in the store Prometheus metrics.
+type querySpan struct {
+	method string
+	start  time.Time
+	span   trace.Span
+}
+
+// startQuery is called at the top of every exported store method, with the
+// span's context replacing the method's ctx and a pointer to its named
+// error result handed to end:
+//
+//	ctx, span := startQuery(ctx, "PostStore.GetByID")
+//	defer span.end(&err)
+func startQuery(ctx context.Context, method string) (context.Context, *querySpan) {
+	ctx, span := tracer.Start(ctx, method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "postgresql"),
+			attribute.String("db.operation.name", method),
+		),
+	)
+
+	return ctx, &querySpan{method: method, start: time.Now(), span: span}
+}
+
+// setRows records how many rows the query returned or affected.
+func (q *querySpan) setRows(n int64) {
+	q.span.SetAttributes(attribute.Int64("db.response.rows", n))
+}
+
+// end finishes the span and records the call. Errors that are part of a
+// method's contract, like ErrNotFound, aren't counted as failures.
+func (q *querySpan) end(err *error) {
+	queryDuration.WithLabelValues(q.method).Observe(time.Since(q.start).Seconds())
+
+	if *err != nil && !isExpectedError(*err) {
+		queryErrors.WithLabelValues(q.method).Inc()
+
+		q.span.RecordError(*err)
+		q.span.SetStatus(codes.Error, (*err).Error())
+	}
+
+	q.span.End()
+}
+
+func isExpectedError(err error) bool {
+	for _, expected := range []error{
+		ErrNotFound,
+		ErrConflict,
+		ErrEditConflict,
+		ErrDuplicateEmail,
+		ErrDuplicateUsername,
+	} {
+		if errors.Is(err, expected) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,165 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// OutboxMaxAttempts is how many times an email is tried before it's given up on.
+const OutboxMaxAttempts = 5
+
+type OutboxEmail struct {
+	ID             int64           `json:"id"`
+	UserID         int64           `json:"user_id"`
+	Template       string          `json:"template"`
+	RecipientName  string          `json:"recipient_name"`
+	RecipientEmail string          `json:"recipient_email"`
+	Data           json.RawMessage `json:"data"`
+	Attempts       int             `json:"attempts"`
+	CreatedAt      string          `json:"created_at"`
+}
+
+// OutboxStore is a transactional outbox: emails are enqueued in the same
+// transaction as the data they refer to, so either both exist or neither
+// does, and are claimed afterwards by a worker that delivers them.
+type OutboxStore struct {
+	db *sql.DB
+}
+
+func (s *OutboxStore) Enqueue(ctx context.Context, tx *sql.Tx, email *OutboxEmail) (err error) {
+	ctx, span := startQuery(ctx, "OutboxStore.Enqueue")
+	defer span.end(&err)
+
+	query := `
+		INSERT INTO email_outbox (user_id, template, recipient_name, recipient_email, data)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return tx.QueryRowContext(
+		ctx,
+		query,
+		email.UserID,
+		email.Template,
+		email.RecipientName,
+		email.RecipientEmail,
+		string(email.Data),
+	).Scan(&email.ID, &email.CreatedAt)
+}
+
+// Claim leases the oldest pending email for lease: it counts as an attempt
+// and no other Claim returns it until the lease runs out. The claim is
+// committed right away so no transaction stays open while the email is
+// sent, the caller then records the outcome with MarkSent or
+// MarkAttemptFailed. ErrNotFound means there's nothing to send.
+//
+// Delivery is at least once: if the process dies after sending but before
+// MarkSent, the email is sent again once the lease runs out. Sending with
+// the email's ID as the idempotency key lets providers drop the copy.
+func (s *OutboxStore) Claim(ctx context.Context, lease time.Duration) (email *OutboxEmail, err error) {
+	ctx, span := startQuery(ctx, "OutboxStore.Claim")
+	defer span.end(&err)
+
+	// SKIP LOCKED keeps replicas claiming at the same time from waiting on
+	// each other, or claiming the same email
+	query := `
+		UPDATE email_outbox
+		SET attempts = attempts + 1, next_attempt_at = NOW() + make_interval(secs => $1)
+		WHERE id = (
+			SELECT id
+			FROM email_outbox
+			WHERE sent_at IS NULL AND failed_at IS NULL AND next_attempt_at <= NOW()
+			ORDER BY id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, COALESCE(user_id, 0), template, recipient_name, recipient_email, data, attempts, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	email = &OutboxEmail{}
+	var data []byte
+	err = s.db.QueryRowContext(ctx, query, lease.Seconds()).Scan(
+		&email.ID,
+		&email.UserID,
+		&email.Template,
+		&email.RecipientName,
+		&email.RecipientEmail,
+		&data,
+		&email.Attempts,
+		&email.CreatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	email.Data = data
+
+	return email, nil
+}
+
+// MarkSent also drops the template data, it can hold secrets like the plain
+// invitation token that shouldn't outlive the delivery.
+func (s *OutboxStore) MarkSent(ctx context.Context, id int64) (err error) {
+	ctx, span := startQuery(ctx, "OutboxStore.MarkSent")
+	defer span.end(&err)
+
+	query := `
+		UPDATE email_outbox
+		SET sent_at = NOW(), last_error = NULL, data = NULL
+		WHERE id = $1 AND sent_at IS NULL
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err = s.db.ExecContext(ctx, query, id)
+	return err
+}
+
+// MarkAttemptFailed schedules the next attempt at a claimed email, or gives
+// up on it when sendErr is permanent or the email has had
+// OutboxMaxAttempts. It reports whether it gave up.
+func (s *OutboxStore) MarkAttemptFailed(ctx context.Context, email *OutboxEmail, sendErr error, permanent bool) (failed bool, err error) {
+	ctx, span := startQuery(ctx, "OutboxStore.MarkAttemptFailed")
+	defer span.end(&err)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	if !permanent && email.Attempts < OutboxMaxAttempts {
+		query := `
+			UPDATE email_outbox
+			SET last_error = $1, next_attempt_at = $2
+			WHERE id = $3 AND sent_at IS NULL
+		`
+
+		// 1, 4, 9, 16 minutes between attempts
+		next := time.Now().Add(time.Duration(email.Attempts*email.Attempts) * time.Minute)
+
+		_, err = s.db.ExecContext(ctx, query, sendErr.Error(), next, email.ID)
+		return false, err
+	}
+
+	query := `
+		UPDATE email_outbox
+		SET last_error = $1, failed_at = NOW(), data = NULL
+		WHERE id = $2 AND sent_at IS NULL
+	`
+
+	_, err = s.db.ExecContext(ctx, query, sendErr.Error(), email.ID)
+	return err == nil, err
+}
@@ -1,22 +1,123 @@
 package store
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 )
 
+// InvalidQueryError reports a malformed query parameter. Its message is
+// written for API clients and can be shown to them as is.
+type InvalidQueryError struct {
+	Detail string
+}
+
+func (e *InvalidQueryError) Error() string { return e.Detail }
+
+func invalidQuery(format string, args ...any) error {
+	return &InvalidQueryError{Detail: fmt.Sprintf(format, args...)}
+}
+
+// PaginatedQuery is the plain limit/offset pagination used by list endpoints
+// that have no filters of their own.
+type PaginatedQuery struct {
+	Limit  int `json:"limit" validate:"gte=1,lte=20"`
+	Offset int `json:"offset" validate:"gte=0"`
+}
+
+func (q PaginatedQuery) Parse(r *http.Request) (PaginatedQuery, error) {
+	qs := r.URL.Query()
+
+	limit := qs.Get("limit")
+	if limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return q, invalidQuery("invalid limit %q: must be an integer", limit)
+		}
+
+		q.Limit = l
+	}
+
+	offset := qs.Get("offset")
+	if offset != "" {
+		o, err := strconv.Atoi(offset)
+		if err != nil {
+			return q, invalidQuery("invalid offset %q: must be an integer", offset)
+		}
+
+		q.Offset = o
+	}
+
+	return q, nil
+}
+
 type PaginatedFeedQuery struct {
-	Limit  int      `json:"limit" validate:"gte=1,lte=20"`
-	Offset int      `json:"offset" validate:"gte=0"`
-	Sort   string   `json:"sort" validate:"oneof=asc desc"`
-	Tags   []string `json:"tags" validate:"max=5"`
-	Search string   `json:"search" validate:"max=100"`
-	Since  string   `json:"since"`
-	Until  string   `json:"until"`
+	Limit  int        `json:"limit" validate:"gte=1,lte=20"`
+	Offset int        `json:"offset" validate:"gte=0"`
+	Sort   string     `json:"sort" validate:"oneof=asc desc"`
+	Tags   []string   `json:"tags" validate:"max=5"`
+	Search string     `json:"search" validate:"max=100"`
+	Since  *time.Time `json:"since"`
+	Until  *time.Time `json:"until"`
+	// After switches to keyset pagination: only posts past it in the sort
+	// order are returned and Offset is ignored.
+	After *Cursor `json:"-"`
 }
 
+// Cursor is the position of a row in a list ordered by (created_at, id),
+// like the feed or comments.
+type Cursor struct {
+	CreatedAt time.Time
+	ID        int64
+}
+
+// CursorOf returns the position of the row with the given created_at, as
+// scanned into a string, and id. It's where the next page starts after.
+func CursorOf(createdAt string, id int64) (Cursor, error) {
+	t, err := time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		return Cursor{}, err
+	}
+
+	return Cursor{CreatedAt: t, ID: id}, nil
+}
+
+// PaginatedCommentsQuery pages through comments oldest first.
+type PaginatedCommentsQuery struct {
+	Limit int `json:"limit" validate:"gte=1,lte=50"`
+	// only comments after it are returned
+	After *Cursor `json:"-"`
+}
+
+// after splits the cursor into query arguments, both nil without one.
+func (q PaginatedCommentsQuery) after() (*time.Time, *int64) {
+	if q.After == nil {
+		return nil, nil
+	}
+
+	return &q.After.CreatedAt, &q.After.ID
+}
+
+func (q PaginatedCommentsQuery) Parse(r *http.Request) (PaginatedCommentsQuery, error) {
+	limit := r.URL.Query().Get("limit")
+	if limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return q, invalidQuery("invalid limit %q: must be an integer", limit)
+		}
+
+		q.Limit = l
+	}
+
+	return q, nil
+}
+
+// Parse reads the feed query string on top of fq's defaults. Malformed
+// values are reported rather than ignored, so clients don't get a feed for
+// a query they didn't ask for.
 func (fq PaginatedFeedQuery) Parse(r *http.Request) (PaginatedFeedQuery, error) {
 	qs := r.URL.Query()
 
@@ -24,7 +125,7 @@ func (fq PaginatedFeedQuery) Parse(r *http.Request) (PaginatedFeedQuery, error)
 	if limit != "" {
 		l, err := strconv.Atoi(limit)
 		if err != nil {
-			return fq, nil
+			return fq, invalidQuery("invalid limit %q: must be an integer", limit)
 		}
 
 		fq.Limit = l
@@ -32,12 +133,12 @@ func (fq PaginatedFeedQuery) Parse(r *http.Request) (PaginatedFeedQuery, error)
 
 	offset := qs.Get("offset")
 	if offset != "" {
-		l, err := strconv.Atoi(offset)
+		o, err := strconv.Atoi(offset)
 		if err != nil {
-			return fq, nil
+			return fq, invalidQuery("invalid offset %q: must be an integer", offset)
 		}
 
-		fq.Offset = l
+		fq.Offset = o
 	}
 
 	sort := qs.Get("sort")
@@ -59,22 +160,41 @@ func (fq PaginatedFeedQuery) Parse(r *http.Request) (PaginatedFeedQuery, error)
 
 	since := qs.Get("since")
 	if since != "" {
-		fq.Since = parseTime(since)
+		t, err := parseTime(since)
+		if err != nil {
+			return fq, invalidQuery("invalid since %q: %v", since, err)
+		}
+
+		fq.Since = &t
 	}
 
 	until := qs.Get("until")
 	if until != "" {
-		fq.Until = parseTime(until)
+		t, err := parseTime(until)
+		if err != nil {
+			return fq, invalidQuery("invalid until %q: %v", until, err)
+		}
+
+		fq.Until = &t
+	}
+
+	if fq.Since != nil && fq.Until != nil && fq.Until.Before(*fq.Since) {
+		return fq, invalidQuery("invalid time window: until must not be before since")
 	}
 
 	return fq, nil
 }
 
-func parseTime(s string) string {
-	t, err := time.Parse(time.DateTime, s)
-	if err != nil {
-		return ""
+// parseTime accepts RFC 3339 timestamps and, for convenience, time.DateTime
+// ones, which are taken to be in UTC.
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+
+	if t, err := time.Parse(time.DateTime, s); err == nil {
+		return t, nil
 	}
 
-	return t.Format(time.DateTime)
+	return time.Time{}, errors.New(`must be an RFC 3339 ("2006-01-02T15:04:05Z07:00") or "2006-01-02 15:04:05" timestamp`)
 }
@@ -0,0 +1,182 @@
+package store
+
+import (
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+const timeFormats = `must be an RFC 3339 ("2006-01-02T15:04:05Z07:00") or "2006-01-02 15:04:05" timestamp`
+
+// checkInvalidQuery fails unless err is an *InvalidQueryError with the given
+// detail, or nil when detail is empty.
+func checkInvalidQuery(t *testing.T, err error, detail string) {
+	t.Helper()
+
+	if detail == "" {
+		if err != nil {
+			t.Fatalf("error = %v, want none", err)
+		}
+		return
+	}
+
+	var queryErr *InvalidQueryError
+	if !errors.As(err, &queryErr) {
+		t.Fatalf("error = %v, want an InvalidQueryError", err)
+	}
+	if queryErr.Detail != detail {
+		t.Errorf("detail = %q, want %q", queryErr.Detail, detail)
+	}
+}
+
+func TestPaginatedFeedQueryParse(t *testing.T) {
+	defaults := PaginatedFeedQuery{Limit: 20, Sort: "desc", Tags: []string{}}
+
+	day := func(d, hour int) *time.Time {
+		at := time.Date(2024, 1, d, hour, 0, 0, 0, time.UTC)
+		return &at
+	}
+
+	tests := []struct {
+		name    string
+		query   string
+		want    PaginatedFeedQuery
+		wantErr string
+	}{
+		{name: "defaults", query: "", want: defaults},
+		{
+			name:  "everything",
+			query: "limit=5&offset=10&sort=asc&tags=go,rust&search=gopher&since=2024-01-01T00:00:00Z&until=2024-01-02+03:00:00",
+			want: PaginatedFeedQuery{
+				Limit: 5, Offset: 10, Sort: "asc", Tags: []string{"go", "rust"}, Search: "gopher",
+				Since: day(1, 0), Until: day(2, 3),
+			},
+		},
+		{name: "one instant", query: "since=2024-01-01T00:00:00Z&until=2024-01-01T00:00:00Z", want: PaginatedFeedQuery{
+			Limit: 20, Sort: "desc", Tags: []string{}, Since: day(1, 0), Until: day(1, 0),
+		}},
+		{name: "bad limit", query: "limit=ten", wantErr: `invalid limit "ten": must be an integer`},
+		{name: "fractional limit", query: "limit=1.5", wantErr: `invalid limit "1.5": must be an integer`},
+		{name: "bad offset", query: "offset=-", wantErr: `invalid offset "-": must be an integer`},
+		{name: "date only since", query: "since=2024-01-01", wantErr: `invalid since "2024-01-01": ` + timeFormats},
+		{name: "bad until", query: "until=yesterday", wantErr: `invalid until "yesterday": ` + timeFormats},
+		{
+			name:    "since after until",
+			query:   "since=2024-01-02T00:00:00Z&until=2024-01-01T00:00:00Z",
+			wantErr: "invalid time window: until must not be before since",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/v1/users/feed?"+tt.query, nil)
+
+			got, err := defaults.Parse(r)
+			checkInvalidQuery(t, err, tt.wantErr)
+			if tt.wantErr != "" {
+				return
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("query = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPaginationParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		wantErr string
+	}{
+		{name: "none", query: ""},
+		{name: "limit", query: "limit=5"},
+		{name: "bad limit", query: "limit=five", wantErr: `invalid limit "five": must be an integer`},
+		{name: "bad offset", query: "offset=1e3", wantErr: `invalid offset "1e3": must be an integer`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/?"+tt.query, nil)
+
+			_, err := PaginatedQuery{Limit: 20}.Parse(r)
+			checkInvalidQuery(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestCommentThreadQueryParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		wantErr string
+	}{
+		{name: "none", query: ""},
+		{name: "all", query: "limit=5&parent=3&depth=2"},
+		{name: "bad limit", query: "limit=x", wantErr: `invalid limit "x": must be an integer`},
+		{name: "bad parent", query: "parent=x", wantErr: `invalid parent "x": must be a comment id`},
+		{name: "bad depth", query: "depth=x", wantErr: `invalid depth "x": must be an integer`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/?"+tt.query, nil)
+
+			_, err := CommentThreadQuery{MaxDepth: 3}.Parse(r)
+			checkInvalidQuery(t, err, tt.wantErr)
+		})
+	}
+}
+
+// Parse only checks the syntax, ranges are left to validation.
+func TestPaginationValidate(t *testing.T) {
+	validate := validator.New(validator.WithRequiredStructEnabled())
+
+	tests := []struct {
+		name      string
+		query     any
+		wantField string
+		wantTag   string
+	}{
+		{name: "feed", query: PaginatedFeedQuery{Limit: 20, Sort: "desc"}},
+		{name: "feed limit above 20", query: PaginatedFeedQuery{Limit: 21, Sort: "desc"}, wantField: "Limit", wantTag: "lte"},
+		{name: "feed limit of 0", query: PaginatedFeedQuery{Limit: 0, Sort: "desc"}, wantField: "Limit", wantTag: "gte"},
+		{name: "feed negative offset", query: PaginatedFeedQuery{Limit: 20, Offset: -1, Sort: "desc"}, wantField: "Offset", wantTag: "gte"},
+		{name: "feed sort", query: PaginatedFeedQuery{Limit: 20, Sort: "up"}, wantField: "Sort", wantTag: "oneof"},
+		{name: "feed tags", query: PaginatedFeedQuery{Limit: 20, Sort: "desc", Tags: make([]string, 6)}, wantField: "Tags", wantTag: "max"},
+		{name: "list limit above 20", query: PaginatedQuery{Limit: 21}, wantField: "Limit", wantTag: "lte"},
+		{name: "comments limit above 50", query: PaginatedCommentsQuery{Limit: 51}, wantField: "Limit", wantTag: "lte"},
+		{
+			name:      "thread depth above 10",
+			query:     CommentThreadQuery{PaginatedCommentsQuery: PaginatedCommentsQuery{Limit: 20}, MaxDepth: 11},
+			wantField: "MaxDepth",
+			wantTag:   "lte",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validate.Struct(tt.query)
+
+			if tt.wantField == "" {
+				if err != nil {
+					t.Fatalf("error = %v, want none", err)
+				}
+				return
+			}
+
+			var errs validator.ValidationErrors
+			if !errors.As(err, &errs) || len(errs) != 1 {
+				t.Fatalf("error = %v, want one validation error", err)
+			}
+			if errs[0].Field() != tt.wantField || errs[0].Tag() != tt.wantTag {
+				t.Errorf("failed %s on %s, want %s on %s", errs[0].Tag(), errs[0].Field(), tt.wantTag, tt.wantField)
+			}
+		})
+	}
+}
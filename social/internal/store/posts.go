@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"time"
 
 	"github.com/lib/pq"
 )
@@ -30,7 +31,28 @@ type PostStore struct {
 	db *sql.DB
 }
 
-func (s *PostStore) GetUserFeed(ctx context.Context, userID int64, fq PaginatedFeedQuery) ([]PostWithMetadata, error) {
+func (s *PostStore) GetUserFeed(ctx context.Context, userID int64, fq PaginatedFeedQuery) (feed []PostWithMetadata, err error) {
+	ctx, span := startQuery(ctx, "PostStore.GetUserFeed")
+	defer span.end(&err)
+
+	// the feed stays in chronological order when searching, ranked results
+	// are what Search is for
+	//
+	// (created_at, id) is unique, so it's both a total order for the feed
+	// and a keyset to resume it from
+	keyset := "<"
+	if fq.Sort == "asc" {
+		keyset = ">"
+	}
+
+	var afterCreatedAt *time.Time
+	var afterID *int64
+	if fq.After != nil {
+		afterCreatedAt = &fq.After.CreatedAt
+		afterID = &fq.After.ID
+		fq.Offset = 0
+	}
+
 	query := `
 		SELECT 
 			p.id, p.user_id, p.title, p.content, p.created_at, p.version, p.tags,
@@ -39,27 +61,29 @@ func (s *PostStore) GetUserFeed(ctx context.Context, userID int64, fq PaginatedF
 		FROM posts p
 		LEFT JOIN comments c ON c.post_id = p.id
 		LEFT JOIN users u ON p.user_id = u.id
-		JOIN followers f ON f.follower_id = p.user_id OR p.user_id = $1
-		WHERE 
-			f.user_id = $1 AND
-			(p.title ILIKE '%' || $4 || '%' OR p.content ILIKE '%' || $4 || '%') AND
-			(p.tags @> $5 OR $5 = '{}')
+		WHERE
+			(p.user_id = $1 OR p.user_id IN (SELECT user_id FROM followers WHERE follower_id = $1)) AND
+			($4 = '' OR p.search @@ to_tsquery('english', $4)) AND
+			(p.tags @> $5 OR $5 = '{}') AND
+			($6::timestamptz IS NULL OR p.created_at >= $6) AND
+			($7::timestamptz IS NULL OR p.created_at <= $7) AND
+			($8::timestamptz IS NULL OR (p.created_at, p.id) ` + keyset + ` ($8, $9::bigint))
 		GROUP BY p.id, u.username
-		ORDER BY p.created_at ` + fq.Sort + `
+		ORDER BY p.created_at ` + fq.Sort + `, p.id ` + fq.Sort + `
 		LIMIT $2 OFFSET $3
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	rows, err := s.db.QueryContext(ctx, query, userID, fq.Limit, fq.Offset, fq.Search, pq.Array(fq.Tags))
+	rows, err := s.db.QueryContext(ctx, query, userID, fq.Limit, fq.Offset, tsQuery(fq.Search), pq.Array(fq.Tags), fq.Since, fq.Until, afterCreatedAt, afterID)
 	if err != nil {
 		return nil, err
 	}
 
 	defer rows.Close()
 
-	var feed []PostWithMetadata
+	feed = make([]PostWithMetadata, 0, fq.Limit)
 	for rows.Next() {
 		var p PostWithMetadata
 		err := rows.Scan(
@@ -79,11 +103,19 @@ func (s *PostStore) GetUserFeed(ctx context.Context, userID int64, fq PaginatedF
 
 		feed = append(feed, p)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	span.setRows(int64(len(feed)))
 
 	return feed, nil
 }
 
-func (s *PostStore) Create(ctx context.Context, post *Post) error {
+func (s *PostStore) Create(ctx context.Context, post *Post) (err error) {
+	ctx, span := startQuery(ctx, "PostStore.Create")
+	defer span.end(&err)
+
 	query := `
 		INSERT INTO posts (content, title, user_id, tags)
 		VALUES ($1, $2, $3, $4) RETURNING id, created_at, updated_at
@@ -92,7 +124,7 @@ func (s *PostStore) Create(ctx context.Context, post *Post) error {
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	err := s.db.QueryRowContext(
+	err = s.db.QueryRowContext(
 		ctx,
 		query,
 		post.Content,
@@ -111,7 +143,10 @@ func (s *PostStore) Create(ctx context.Context, post *Post) error {
 	return nil
 }
 
-func (s *PostStore) GetByID(ctx context.Context, id int64) (*Post, error) {
+func (s *PostStore) GetByID(ctx context.Context, id int64) (post *Post, err error) {
+	ctx, span := startQuery(ctx, "PostStore.GetByID")
+	defer span.end(&err)
+
 	query := `
 		SELECT id, user_id, title, content, created_at,  updated_at, tags, version
 		FROM posts
@@ -121,8 +156,8 @@ func (s *PostStore) GetByID(ctx context.Context, id int64) (*Post, error) {
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	var post Post
-	err := s.db.QueryRowContext(ctx, query, id).Scan(
+	post = &Post{}
+	err = s.db.QueryRowContext(ctx, query, id).Scan(
 		&post.ID,
 		&post.UserID,
 		&post.Title,
@@ -141,10 +176,13 @@ func (s *PostStore) GetByID(ctx context.Context, id int64) (*Post, error) {
 		}
 	}
 
-	return &post, nil
+	return post, nil
 }
 
-func (s *PostStore) Delete(ctx context.Context, postID int64) error {
+func (s *PostStore) Delete(ctx context.Context, postID int64) (err error) {
+	ctx, span := startQuery(ctx, "PostStore.Delete")
+	defer span.end(&err)
+
 	query := `DELETE FROM posts WHERE id = $1`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
@@ -160,6 +198,8 @@ func (s *PostStore) Delete(ctx context.Context, postID int64) error {
 		return err
 	}
 
+	span.setRows(rows)
+
 	if rows == 0 {
 		return ErrNotFound
 	}
@@ -167,7 +207,10 @@ func (s *PostStore) Delete(ctx context.Context, postID int64) error {
 	return nil
 }
 
-func (s *PostStore) Update(ctx context.Context, post *Post) error {
+func (s *PostStore) Update(ctx context.Context, post *Post) (err error) {
+	ctx, span := startQuery(ctx, "PostStore.Update")
+	defer span.end(&err)
+
 	query := `
 		UPDATE posts
 		SET title = $1, content = $2, version = version + 1
@@ -178,7 +221,7 @@ func (s *PostStore) Update(ctx context.Context, post *Post) error {
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	err := s.db.QueryRowContext(
+	err = s.db.QueryRowContext(
 		ctx,
 		query,
 		post.Title,
@@ -189,7 +232,8 @@ func (s *PostStore) Update(ctx context.Context, post *Post) error {
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
-			return ErrNotFound
+			// no row matched id and version, find out which one failed
+			return s.updateMissError(ctx, post.ID)
 		default:
 			return err
 		}
@@ -197,3 +241,20 @@ func (s *PostStore) Update(ctx context.Context, post *Post) error {
 
 	return nil
 }
+
+// updateMissError tells a post that no longer exists (ErrNotFound) apart
+// from one that was updated by someone else since it was read (ErrEditConflict).
+func (s *PostStore) updateMissError(ctx context.Context, postID int64) error {
+	query := `SELECT EXISTS (SELECT 1 FROM posts WHERE id = $1)`
+
+	var exists bool
+	if err := s.db.QueryRowContext(ctx, query, postID).Scan(&exists); err != nil {
+		return err
+	}
+
+	if !exists {
+		return ErrNotFound
+	}
+
+	return ErrEditConflict
+}
@@ -0,0 +1,149 @@
+package store
+
+import (
+	"context"
+	"html"
+	"strings"
+	"unicode"
+
+	"github.com/lib/pq"
+)
+
+// PostSearchResult is a post matching a search, with its matches wrapped
+// in <mark> tags. Everything else in the highlights is HTML escaped.
+type PostSearchResult struct {
+	Post
+	Rank           float64 `json:"rank"`
+	TitleHighlight string  `json:"title_highlight"`
+	Snippet        string  `json:"snippet"`
+}
+
+// Search returns the posts matching q, best matches first. q is a list of
+// words that must all match; "quoted words" must appear next to each other
+// and a trailing * matches any word with that prefix, as in gopher*.
+func (s *PostStore) Search(ctx context.Context, q string, pg PaginatedQuery) (results []PostSearchResult, err error) {
+	ctx, span := startQuery(ctx, "PostStore.Search")
+	defer span.end(&err)
+
+	query := `
+		SELECT
+			p.id, p.user_id, p.title, p.content, p.created_at, p.updated_at, p.tags, p.version,
+			u.username,
+			ts_rank(p.search, q) AS rank,
+			ts_headline('english', p.title, q, 'StartSel=<mark>, StopSel=</mark>, HighlightAll=true'),
+			ts_headline('english', p.content, q, 'StartSel=<mark>, StopSel=</mark>, MaxFragments=2, MinWords=5, MaxWords=20')
+		FROM posts p
+		JOIN users u ON u.id = p.user_id
+		CROSS JOIN to_tsquery('english', $1) AS q
+		WHERE p.search @@ q
+		ORDER BY rank DESC, p.created_at DESC, p.id DESC
+		LIMIT $2 OFFSET $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, tsQuery(q), pg.Limit, pg.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results = []PostSearchResult{}
+	for rows.Next() {
+		var res PostSearchResult
+		err := rows.Scan(
+			&res.ID,
+			&res.UserID,
+			&res.Title,
+			&res.Content,
+			&res.CreatedAt,
+			&res.UpdatedAt,
+			pq.Array(&res.Tags),
+			&res.Version,
+			&res.User.Username,
+			&res.Rank,
+			&res.TitleHighlight,
+			&res.Snippet,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		res.User.ID = res.UserID
+		res.TitleHighlight = escapeHighlight(res.TitleHighlight)
+		res.Snippet = escapeHighlight(res.Snippet)
+
+		results = append(results, res)
+	}
+
+	span.setRows(int64(len(results)))
+
+	return results, rows.Err()
+}
+
+// tsQuery turns a search as described on Search into to_tsquery syntax.
+// Only letters and digits make it into the query, so users can't inject
+// tsquery operators. It returns "" when q has no words at all.
+func tsQuery(q string) string {
+	var terms []string
+
+	// odd segments were inside quotes
+	for i, segment := range strings.Split(q, `"`) {
+		if i%2 == 1 {
+			if phrase := tsPhrase(strings.Fields(segment)); phrase != "" {
+				terms = append(terms, phrase)
+			}
+			continue
+		}
+
+		for _, word := range strings.Fields(segment) {
+			if term := tsPhrase([]string{word}); term != "" {
+				terms = append(terms, term)
+			}
+		}
+	}
+
+	return strings.Join(terms, " & ")
+}
+
+// tsPhrase matches words next to each other, a word ending in * matches
+// as a prefix.
+func tsPhrase(words []string) string {
+	var lexemes []string
+	for _, word := range words {
+		prefix := strings.HasSuffix(word, "*")
+
+		// "e-mail" is a phrase of its own, like Postgres parses it
+		parts := strings.FieldsFunc(word, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		if len(parts) == 0 {
+			continue
+		}
+
+		if prefix {
+			parts[len(parts)-1] += ":*"
+		}
+		lexemes = append(lexemes, parts...)
+	}
+
+	switch len(lexemes) {
+	case 0:
+		return ""
+	case 1:
+		return lexemes[0]
+	}
+
+	return "(" + strings.Join(lexemes, " <-> ") + ")"
+}
+
+// escapeHighlight HTML escapes a ts_headline result except for its <mark>
+// tags, so it can be rendered as is.
+func escapeHighlight(s string) string {
+	s = html.EscapeString(s)
+	s = strings.ReplaceAll(s, "&lt;mark&gt;", "<mark>")
+	s = strings.ReplaceAll(s, "&lt;/mark&gt;", "</mark>")
+
+	return s
+}
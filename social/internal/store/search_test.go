@@ -0,0 +1,93 @@
+package store
+
+import "testing"
+
+func TestTsQuery(t *testing.T) {
+	tests := []struct {
+		name string
+		q    string
+		want string
+	}{
+		{name: "word", q: "gopher", want: "gopher"},
+		{name: "words", q: "  go   gopher ", want: "go & gopher"},
+		{name: "prefix", q: "gopher*", want: "gopher:*"},
+		{name: "repeated star", q: "gopher**", want: "gopher:*"},
+		{name: "star inside a word", q: "go*pher", want: "(go <-> pher)"},
+		{name: "phrase", q: `"hello world"`, want: "(hello <-> world)"},
+		{name: "phrase with a prefix", q: `"hello wor*"`, want: "(hello <-> wor:*)"},
+		{name: "phrase of one word", q: `"hello"`, want: "hello"},
+		{name: "phrase between words", q: `go "hello world" rust`, want: "go & (hello <-> world) & rust"},
+		{name: "unclosed quote", q: `go "hello world`, want: "go & (hello <-> world)"},
+		{name: "hyphenated word", q: "e-mail", want: "(e <-> mail)"},
+		{name: "unicode", q: "café über", want: "café & über"},
+		{
+			name: "operators stripped",
+			q:    `a & b | !c (d) e:f g<->h`,
+			want: "a & b & c & d & (e <-> f) & (g <-> h)",
+		},
+		{name: "single quotes stripped", q: "'go' don't", want: "go & (don <-> t)"},
+		{name: "empty", q: "", want: ""},
+		{name: "spaces", q: "   ", want: ""},
+		{name: "empty phrase", q: `""`, want: ""},
+		{name: "operators only", q: `& | ! ( ) : <-> * "*" ''`, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tsQuery(tt.q); got != tt.want {
+				t.Errorf("tsQuery(%q) = %q, want %q", tt.q, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTsPhrase(t *testing.T) {
+	tests := []struct {
+		name  string
+		words []string
+		want  string
+	}{
+		{name: "none", words: nil, want: ""},
+		{name: "one", words: []string{"go"}, want: "go"},
+		{name: "two", words: []string{"go", "gopher"}, want: "(go <-> gopher)"},
+		{name: "prefix last", words: []string{"go", "goph*"}, want: "(go <-> goph:*)"},
+		{name: "prefix first", words: []string{"go*", "gopher"}, want: "(go:* <-> gopher)"},
+		{name: "prefix of a split word", words: []string{"e-mai*"}, want: "(e <-> mai:*)"},
+		{name: "operators skipped", words: []string{"go", "<->", "!", "gopher"}, want: "(go <-> gopher)"},
+		{name: "operators only", words: []string{"&", "|", "*"}, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tsPhrase(tt.words); got != tt.want {
+				t.Errorf("tsPhrase(%q) = %q, want %q", tt.words, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEscapeHighlight(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		want string
+	}{
+		{name: "plain", s: "gophers", want: "gophers"},
+		{name: "marks kept", s: "the <mark>gopher</mark> digs", want: "the <mark>gopher</mark> digs"},
+		{
+			name: "html escaped",
+			s:    `<mark>go</mark> & <script>alert("x's")</script>`,
+			want: "<mark>go</mark> &amp; &lt;script&gt;alert(&#34;x&#39;s&#34;)&lt;/script&gt;",
+		},
+		{name: "other case marks escaped", s: "<MARK>go</MARK>", want: "&lt;MARK&gt;go&lt;/MARK&gt;"},
+		{name: "mark with attributes escaped", s: `<mark class="x">go</mark>`, want: "&lt;mark class=&#34;x&#34;&gt;go</mark>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := escapeHighlight(tt.s); got != tt.want {
+				t.Errorf("escapeHighlight(%q) = %q, want %q", tt.s, got, tt.want)
+			}
+		})
+	}
+}
@@ -10,6 +10,7 @@ import (
 var (
 	ErrNotFound          = errors.New("resource not found")
 	ErrConflict          = errors.New("resource already exists")
+	ErrEditConflict      = errors.New("resource was modified concurrently")
 	QueryTimeoutDuration = time.Second * 5
 )
 
@@ -20,31 +21,79 @@ type Storage struct {
 		Delete(context.Context, int64) error
 		Update(context.Context, *Post) error
 		GetUserFeed(context.Context, int64, PaginatedFeedQuery) ([]PostWithMetadata, error)
+		Search(context.Context, string, PaginatedQuery) ([]PostSearchResult, error)
 	}
 	Users interface {
-		Create(context.Context, *User) error
+		GetByID(context.Context, int64) (*User, error)
+		GetByEmail(context.Context, string) (*User, error)
+		GetByUsername(context.Context, string) (*User, error)
+		Create(context.Context, *sql.Tx, *User) error
+		CreateAndInvite(ctx context.Context, user *User, token string, exp time.Duration, invitation *OutboxEmail) error
+		Activate(context.Context, string) (int64, error)
+		DeleteExpiredInvitations(context.Context) (int64, error)
 	}
 	Comments interface {
 		Create(context.Context, *Comment) error
-		GetByPostID(context.Context, int64) ([]Comment, error)
+		GetByID(context.Context, int64) (*Comment, error)
+		Update(context.Context, *Comment) error
+		Delete(context.Context, int64) error
+		GetByPostID(context.Context, int64, PaginatedCommentsQuery) ([]Comment, error)
+		CountByPostID(context.Context, int64) (int, error)
+		GetThread(context.Context, int64, CommentThreadQuery) ([]Comment, error)
+	}
+	Roles interface {
+		GetByName(context.Context, string) (*Role, error)
+	}
+	Followers interface {
+		Follow(ctx context.Context, followerID, userID int64) error
+		Unfollow(ctx context.Context, followerID, userID int64) error
+		ListFollowers(context.Context, int64, PaginatedQuery) ([]Follower, error)
+		ListFollowing(context.Context, int64, PaginatedQuery) ([]Follower, error)
+		Counts(context.Context, int64) (followers, following int64, err error)
+	}
+	Outbox interface {
+		Enqueue(context.Context, *sql.Tx, *OutboxEmail) error
+		Claim(ctx context.Context, lease time.Duration) (*OutboxEmail, error)
+		MarkSent(context.Context, int64) error
+		MarkAttemptFailed(ctx context.Context, email *OutboxEmail, sendErr error, permanent bool) (bool, error)
 	}
 }
 
 func NewStorage(db *sql.DB) Storage {
 	return Storage{
-		Posts:    &PostStore{db},
-		Users:    &UserStore{db},
-		Comments: &CommentStore{db},
-		// Followers: &FollowerStore{db},
-		// Roles:     &RoleStore{db},
+		Posts:     &PostStore{db},
+		Users:     &UserStore{db},
+		Comments:  &CommentStore{db},
+		Roles:     &RoleStore{db},
+		Followers: &FollowerStore{db},
+		Outbox:    &OutboxStore{db},
 	}
 }
 
 // make one for each type of DB
 func NewPostgresStorage(db *sql.DB) Storage {
 	return Storage{
-		Posts:    &PostStore{db},
-		Users:    &UserStore{db},
-		Comments: &CommentStore{db},
+		Posts:     &PostStore{db},
+		Users:     &UserStore{db},
+		Comments:  &CommentStore{db},
+		Roles:     &RoleStore{db},
+		Followers: &FollowerStore{db},
+		Outbox:    &OutboxStore{db},
+	}
+}
+
+// withTx runs fn inside a transaction, rolling back if fn returns an error
+// and committing otherwise.
+func withTx(db *sql.DB, ctx context.Context, fn func(*sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
 	}
+
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
 }
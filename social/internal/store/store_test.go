@@ -0,0 +1,87 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"social/cmd/migrate/migrations"
+	"social/internal/migrate"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+// newTestDB creates a migrated database next to the one TEST_DB_ADDR points
+// at, dropped when the test ends. The test is skipped without TEST_DB_ADDR.
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	addr := os.Getenv("TEST_DB_ADDR")
+	if addr == "" {
+		t.Skip("TEST_DB_ADDR not set")
+	}
+
+	admin, err := sql.Open("postgres", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	name := fmt.Sprintf("social_store_test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec("CREATE DATABASE " + name); err != nil {
+		t.Fatalf("creating database: %v", err)
+	}
+
+	u, err := url.Parse(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.Path = "/" + name
+
+	db, err := sql.Open("postgres", u.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		db.Close()
+		if _, err := admin.Exec("DROP DATABASE IF EXISTS " + name); err != nil {
+			t.Errorf("dropping database: %v", err)
+		}
+	})
+
+	m, err := migrate.New(db, migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Up(context.Background()); err != nil {
+		t.Fatalf("migrating: %v", err)
+	}
+
+	return db
+}
+
+// newTestPost creates a user and a post of theirs to hang comments on.
+func newTestPost(t *testing.T, db *sql.DB) *Post {
+	t.Helper()
+
+	post := &Post{Title: "title", Content: "content"}
+
+	err := db.QueryRow(`
+		INSERT INTO users (username, password, email, role_id, is_active)
+		VALUES ('gopher', '\x00', 'gopher@example.com', (SELECT id FROM roles WHERE name = 'user'), true)
+		RETURNING id
+	`).Scan(&post.UserID)
+	if err != nil {
+		t.Fatalf("creating user: %v", err)
+	}
+
+	if err := (&PostStore{db}).Create(context.Background(), post); err != nil {
+		t.Fatalf("creating post: %v", err)
+	}
+
+	return post
+}
@@ -2,19 +2,63 @@ package store
 
 import (
 	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrDuplicateEmail    = errors.New("a user with that email already exists")
+	ErrDuplicateUsername = errors.New("a user with that username already exists")
 )
 
 type User struct {
-	ID       int64  `json:"id"`
-	Username string `json:"username"`
-	Email    string `json:"email"`
-	// Password  password `json:"-"`
-	Password  string `json:"-"`
-	CreatedAt string `json:"created_at"`
-	// IsActive  bool     `json:"is_active"`
-	// RoleID    int64    `json:"role_id"`
-	// Role      Role     `json:"role"`
+	ID        int64    `json:"id"`
+	Username  string   `json:"username"`
+	Email     string   `json:"email"`
+	Password  password `json:"-"`
+	CreatedAt string   `json:"created_at"`
+	IsActive  bool     `json:"is_active,omitempty"`
+	RoleID    int64    `json:"role_id,omitempty"`
+	Role      Role     `json:"role,omitzero"`
+}
+
+// password keeps the plain text around only for the lifetime of the request
+// that set it; the hash is what gets stored in the users.password column.
+type password struct {
+	text *string
+	hash []byte
+}
+
+func (p *password) Set(text string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(text), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	p.text = &text
+	p.hash = hash
+
+	return nil
+}
+
+func (p *password) Compare(text string) error {
+	return bcrypt.CompareHashAndPassword(p.hash, []byte(text))
+}
+
+// dummyPasswordHash is a bcrypt hash at bcrypt.DefaultCost of a password no
+// account has.
+var dummyPasswordHash = []byte("$2a$10$2FISbIoirdC81JlgZKKkauuojth4ut1yzm8pPkmnpQqG81.eMOreO")
+
+// CompareDummyPassword takes as long as a Compare that fails. It stands in
+// for Compare when there's no user to check text against, so the time taken
+// to answer doesn't tell whether the user exists.
+func CompareDummyPassword(text string) {
+	_ = bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(text))
 }
 
 // this is for Postgres
@@ -23,26 +67,329 @@ type UserStore struct {
 	db *sql.DB
 }
 
-func (s *UserStore) Create(ctx context.Context, user *User) error {
+// Create inserts user inside tx. Users signing up start out inactive until
+// they accept their invitation, only the seed creates them active.
+func (s *UserStore) Create(ctx context.Context, tx *sql.Tx, user *User) (err error) {
+	ctx, span := startQuery(ctx, "UserStore.Create")
+	defer span.end(&err)
+
 	query := `
-		INSERT INTO users (username, password, email) VALUES 
-    ($1, $2, $3)
-    RETURNING id, created_at
+		INSERT INTO users (username, password, email, role_id, is_active) VALUES
+    ($1, $2, $3, (SELECT id FROM roles WHERE name = $4), $5)
+    RETURNING id, created_at, role_id
 	`
 
-	err := s.db.QueryRowContext(
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	role := user.Role.Name
+	if role == "" {
+		role = "user"
+	}
+
+	err = tx.QueryRowContext(
 		ctx,
 		query,
 		user.Username,
-		user.Password,
+		user.Password.hash,
 		user.Email,
+		role,
+		user.IsActive,
 	).Scan(
 		&user.ID,
 		&user.CreatedAt,
+		&user.RoleID,
 	)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
+			return ErrDuplicateEmail
+		case err.Error() == `pq: duplicate key value violates unique constraint "users_username_key"`:
+			return ErrDuplicateUsername
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *UserStore) GetByID(ctx context.Context, userID int64) (user *User, err error) {
+	ctx, span := startQuery(ctx, "UserStore.GetByID")
+	defer span.end(&err)
+
+	query := `
+		SELECT u.id, u.username, u.email, u.password, u.created_at, u.is_active, u.role_id,
+			r.id, r.name, r.level, r.description
+		FROM users u
+		JOIN roles r ON r.id = u.role_id
+		WHERE u.id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	user = &User{}
+	err = s.db.QueryRowContext(ctx, query, userID).Scan(
+		&user.ID,
+		&user.Username,
+		&user.Email,
+		&user.Password.hash,
+		&user.CreatedAt,
+		&user.IsActive,
+		&user.RoleID,
+		&user.Role.ID,
+		&user.Role.Name,
+		&user.Role.Level,
+		&user.Role.Description,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return user, nil
+}
+
+func (s *UserStore) GetByUsername(ctx context.Context, username string) (user *User, err error) {
+	ctx, span := startQuery(ctx, "UserStore.GetByUsername")
+	defer span.end(&err)
+
+	query := `
+		SELECT u.id, u.username, u.email, u.password, u.created_at, u.is_active, u.role_id,
+			r.id, r.name, r.level, r.description
+		FROM users u
+		JOIN roles r ON r.id = u.role_id
+		WHERE u.username = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	user = &User{}
+	err = s.db.QueryRowContext(ctx, query, username).Scan(
+		&user.ID,
+		&user.Username,
+		&user.Email,
+		&user.Password.hash,
+		&user.CreatedAt,
+		&user.IsActive,
+		&user.RoleID,
+		&user.Role.ID,
+		&user.Role.Name,
+		&user.Role.Level,
+		&user.Role.Description,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return user, nil
+}
+
+// GetByEmail only returns active users, it's what credentials are checked
+// against when issuing tokens.
+func (s *UserStore) GetByEmail(ctx context.Context, email string) (user *User, err error) {
+	ctx, span := startQuery(ctx, "UserStore.GetByEmail")
+	defer span.end(&err)
+
+	query := `
+		SELECT u.id, u.username, u.email, u.password, u.created_at, u.is_active, u.role_id,
+			r.id, r.name, r.level, r.description
+		FROM users u
+		JOIN roles r ON r.id = u.role_id
+		WHERE u.email = $1 AND u.is_active = true
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	user = &User{}
+	err = s.db.QueryRowContext(ctx, query, email).Scan(
+		&user.ID,
+		&user.Username,
+		&user.Email,
+		&user.Password.hash,
+		&user.CreatedAt,
+		&user.IsActive,
+		&user.RoleID,
+		&user.Role.ID,
+		&user.Role.Name,
+		&user.Role.Level,
+		&user.Role.Description,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return user, nil
+}
+
+// CreateAndInvite stores the user together with the hash of the plain
+// invitation token and queues the invitation email in the outbox. All rows
+// are written in the same transaction so a user can never exist without a
+// way to activate the account.
+func (s *UserStore) CreateAndInvite(ctx context.Context, user *User, token string, invitationExp time.Duration, invitation *OutboxEmail) (err error) {
+	ctx, span := startQuery(ctx, "UserStore.CreateAndInvite")
+	defer span.end(&err)
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		if err := s.Create(ctx, tx, user); err != nil {
+			return err
+		}
+
+		if err := s.createUserInvitation(ctx, tx, token, invitationExp, user.ID); err != nil {
+			return err
+		}
+
+		invitation.UserID = user.ID
+		outbox := &OutboxStore{s.db}
+
+		return outbox.Enqueue(ctx, tx, invitation)
+	})
+}
+
+func (s *UserStore) createUserInvitation(ctx context.Context, tx *sql.Tx, token string, exp time.Duration, userID int64) error {
+	query := `INSERT INTO user_invitations (token, user_id, expiry) VALUES ($1, $2, $3)`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, hashToken(token), userID, time.Now().Add(exp))
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Activate looks up the user owning the (plain) invitation token, marks it
+// active and removes its invitations in a single transaction, returning its
+// id. Unknown and expired tokens both yield ErrNotFound.
+func (s *UserStore) Activate(ctx context.Context, token string) (userID int64, err error) {
+	ctx, span := startQuery(ctx, "UserStore.Activate")
+	defer span.end(&err)
+
+	err = withTx(s.db, ctx, func(tx *sql.Tx) error {
+		user, err := s.getUserFromInvitation(ctx, tx, token)
+		if err != nil {
+			return err
+		}
+
+		user.IsActive = true
+		if err := s.update(ctx, tx, user); err != nil {
+			return err
+		}
+
+		userID = user.ID
+
+		return s.deleteUserInvitations(ctx, tx, user.ID)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return userID, nil
+}
+
+func (s *UserStore) getUserFromInvitation(ctx context.Context, tx *sql.Tx, token string) (*User, error) {
+	query := `
+		SELECT u.id, u.username, u.email, u.created_at, u.is_active
+		FROM users u
+		JOIN user_invitations ui ON u.id = ui.user_id
+		WHERE ui.token = $1 AND ui.expiry > $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	user := &User{}
+	err := tx.QueryRowContext(ctx, query, hashToken(token), time.Now()).Scan(
+		&user.ID,
+		&user.Username,
+		&user.Email,
+		&user.CreatedAt,
+		&user.IsActive,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return user, nil
+}
+
+func (s *UserStore) update(ctx context.Context, tx *sql.Tx, user *User) error {
+	query := `UPDATE users SET username = $1, email = $2, is_active = $3 WHERE id = $4`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, user.Username, user.Email, user.IsActive, user.ID)
 	if err != nil {
 		return err
 	}
 
 	return nil
 }
+
+func (s *UserStore) deleteUserInvitations(ctx context.Context, tx *sql.Tx, userID int64) error {
+	query := `DELETE FROM user_invitations WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteExpiredInvitations removes every invitation past its expiry and
+// returns how many were deleted.
+func (s *UserStore) DeleteExpiredInvitations(ctx context.Context) (deleted int64, err error) {
+	ctx, span := startQuery(ctx, "UserStore.DeleteExpiredInvitations")
+	defer span.end(&err)
+
+	query := `DELETE FROM user_invitations WHERE expiry <= $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	deleted, err = res.RowsAffected()
+	span.setRows(deleted)
+
+	return deleted, err
+}
+
+// hashToken is applied to invitation tokens before they touch the database,
+// so a leaked user_invitations table can't be used to activate accounts.
+func hashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
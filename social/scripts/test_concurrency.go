@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"os"
 	"sync"
 )
 
@@ -30,6 +31,8 @@ func updatePost(postID int, p UpdatePostPayload, wg *sync.WaitGroup) {
 
 	// Set headers as needed, for example:
 	req.Header.Set("Content-Type", "application/json")
+	// PATCH /v1/posts/{postID} requires a token, see POST /v1/authentication/token
+	req.Header.Set("Authorization", "Bearer "+os.Getenv("AUTH_TOKEN"))
 
 	// Send the request
 	client := &http.Client{}
@@ -40,6 +43,7 @@ func updatePost(postID int, p UpdatePostPayload, wg *sync.WaitGroup) {
 	}
 	defer resp.Body.Close()
 
+	// 200 for the update that won, 409 for the one that lost the race
 	fmt.Println("Update response status:", resp.Status)
 }
 